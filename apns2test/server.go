@@ -0,0 +1,203 @@
+// Package apns2test provides a mock APNs server for end-to-end testing of
+// code which sends notifications with apns2.
+package apns2test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mkc-bill/apns2"
+)
+
+// Request is a request received by the Server.
+type Request struct {
+	Method      string
+	Path        string
+	DeviceToken string
+	ChannelID   string
+	Header      http.Header
+	Body        []byte
+}
+
+// AssertHeader reports a test error if the request header key does not
+// have the value want.
+func (r *Request) AssertHeader(t testing.TB, key, want string) {
+	t.Helper()
+	if got := r.Header.Get(key); got != want {
+		t.Errorf("apns2test: header %s = %q, want %q", key, got, want)
+	}
+}
+
+// AssertPayload reports a test error if the request body is not JSON
+// semantically equal to want, ignoring key order and whitespace.
+func (r *Request) AssertPayload(t testing.TB, want string) {
+	t.Helper()
+	var got, expected interface{}
+	if err := json.Unmarshal(r.Body, &got); err != nil {
+		t.Errorf("apns2test: payload is not valid JSON: %v: %s", err, r.Body)
+		return
+	}
+	if err := json.Unmarshal([]byte(want), &expected); err != nil {
+		t.Errorf("apns2test: expected payload is not valid JSON: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("apns2test: payload = %s, want %s", r.Body, want)
+	}
+}
+
+// PayloadsEqual reports whether a and b are semantically equal JSON
+// documents, regardless of key order and whitespace, so that generated
+// payloads can be compared in tests. It returns false if either is not valid
+// JSON.
+func PayloadsEqual(a, b []byte) bool {
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// Server is a mock APNs server listening on the loopback interface over
+// HTTP/2 with TLS. It records every request it receives and, by default,
+// accepts every notification. It also serves the broadcast channel
+// management API, so channels can be created and then broadcast to; a
+// broadcast to a channel it did not create is rejected with
+// ChannelNotRegistered.
+type Server struct {
+	// The base URL of the server, suitable for use as a Client Host.
+	URL string
+
+	server   *httptest.Server
+	mu       sync.Mutex
+	requests []*Request
+	status   int
+	reason   string
+	channels map[string]bool
+}
+
+// NewServer starts and returns a new Server. The caller should call Close
+// when finished to shut it down.
+func NewServer() *Server {
+	s := &Server{status: http.StatusOK, channels: map[string]bool{}}
+	s.server = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	s.server.EnableHTTP2 = true
+	s.server.StartTLS()
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Client returns an apns2.Client configured to send pushes to the server and
+// to trust its certificate. Set its Token to exercise token authentication.
+func (s *Server) Client() *apns2.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.server.Certificate())
+	client := apns2.NewClientWithTransport(apns2.NewTransport(nil)).WithRootCAs(pool)
+	client.Host = s.URL
+	client.ManageHost = s.URL
+	return client
+}
+
+// RespondWith makes the server reject subsequent requests with the given
+// HTTP status code and APNs reason. Use http.StatusOK to accept them again.
+func (s *Server) RespondWith(status int, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.reason = reason
+}
+
+// Requests returns the requests received by the server, in order.
+func (s *Server) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Request(nil), s.requests...)
+}
+
+// LastRequest returns the most recent request received by the server, or
+// nil if there has been none.
+func (s *Server) LastRequest() *Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		return nil
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	req := &Request{
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		ChannelID: r.Header.Get("apns-channel-id"),
+		Header:    r.Header.Clone(),
+		Body:      body,
+	}
+	if strings.HasPrefix(r.URL.Path, "/3/device/") {
+		req.DeviceToken = strings.TrimPrefix(r.URL.Path, "/3/device/")
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	status, reason := s.status, s.reason
+	if status == http.StatusOK && strings.HasPrefix(r.URL.Path, "/1/apps/") && strings.HasSuffix(r.URL.Path, "/channels") {
+		channelID := newChannelID()
+		s.channels[channelID] = true
+		s.mu.Unlock()
+		w.Header().Set("apns-request-id", newUUID())
+		w.Header().Set("apns-channel-id", channelID)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	if status == http.StatusOK && strings.HasPrefix(r.URL.Path, "/4/broadcasts/") && !s.channels[req.ChannelID] {
+		status, reason = http.StatusBadRequest, apns2.ReasonChannelNotRegistered
+	}
+	s.mu.Unlock()
+
+	apnsID := r.Header.Get("apns-id")
+	if apnsID == "" {
+		apnsID = newUUID()
+	}
+	w.Header().Set("apns-id", apnsID)
+	if status == http.StatusOK {
+		w.Header().Set("apns-unique-id", newUUID())
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(map[string]string{"reason": reason})
+	w.Write(buf.Bytes())
+}
+
+func newChannelID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
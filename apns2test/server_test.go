@@ -0,0 +1,120 @@
+package apns2test_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/mkc-bill/apns2"
+	"github.com/mkc-bill/apns2/apns2test"
+	liveactivity "github.com/mkc-bill/apns2/liveactivitypayload"
+	"github.com/stretchr/testify/assert"
+)
+
+const liveActivityToken = "11aa01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7"
+
+func liveActivityNotification(p *liveactivity.Payload) *apns2.Notification {
+	return &apns2.Notification{
+		DeviceToken: liveActivityToken,
+		Topic:       "com.example.app" + apns2.LiveActivityTopicSuffix,
+		PushType:    apns2.LiveActivity,
+		Priority:    apns2.PriorityHigh,
+		Payload:     p,
+	}
+}
+
+func TestLiveActivityEndToEnd(t *testing.T) {
+	server := apns2test.NewServer()
+	defer server.Close()
+	client := server.Client()
+
+	start := liveactivity.NewPayload().Event(liveactivity.EventStart).Timestamp(1000).
+		Attributes("ScoreAttributes", map[string]string{"team": "home"}).
+		ContentState(map[string]int{"score": 0})
+	update := liveactivity.NewPayload().Event(liveactivity.EventUpdate).Timestamp(1001).
+		ContentState(map[string]int{"score": 1})
+	end := liveactivity.NewPayload().End().Timestamp(1002).DismissalDate(2000)
+
+	for _, p := range []*liveactivity.Payload{start, update, end} {
+		res, err := client.Push(liveActivityNotification(p))
+		assert.NoError(t, err)
+		assert.True(t, res.Sent())
+		assert.NotEmpty(t, res.ApnsUniqueId)
+	}
+
+	requests := server.Requests()
+	assert.Len(t, requests, 3)
+	for _, r := range requests {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, liveActivityToken, r.DeviceToken)
+		r.AssertHeader(t, "apns-push-type", "liveactivity")
+		r.AssertHeader(t, "apns-topic", "com.example.app.push-type.liveactivity")
+		r.AssertHeader(t, "apns-priority", "10")
+	}
+	requests[0].AssertPayload(t, `{"aps":{"event":"start","timestamp":1000,"attributes-type":"ScoreAttributes","attributes":{"team":"home"},"content-state":{"score":0}}}`)
+	requests[1].AssertPayload(t, `{"aps":{"event":"update","timestamp":1001,"content-state":{"score":1}}}`)
+	requests[2].AssertPayload(t, `{"aps":{"event":"end","timestamp":1002,"dismissal-date":2000}}`)
+}
+
+func TestRespondWith(t *testing.T) {
+	server := apns2test.NewServer()
+	defer server.Close()
+	server.RespondWith(http.StatusGone, apns2.ReasonUnregistered)
+
+	res, err := server.Client().Push(liveActivityNotification(liveactivity.NewPayload().End().Timestamp(1)))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusGone, res.StatusCode)
+	assert.Equal(t, apns2.ReasonUnregistered, res.Reason)
+	assert.NotEmpty(t, res.ApnsID)
+	assert.Len(t, server.Requests(), 1)
+}
+
+func TestBroadcastEndToEnd(t *testing.T) {
+	server := apns2test.NewServer()
+	defer server.Close()
+	client := server.Client().WithDefaultTopic("com.example.app")
+
+	channelID, err := client.CreateChannel(context.Background(), apns2.StoragePolicyMostRecent)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, channelID)
+
+	update := liveactivity.NewPayload().Event(liveactivity.EventUpdate).Timestamp(1001).
+		ContentState(map[string]int{"score": 1})
+	res, err := client.Broadcast(channelID, update)
+	assert.NoError(t, err)
+	assert.True(t, res.Sent())
+
+	requests := server.Requests()
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "/1/apps/com.example.app/channels", requests[0].Path)
+	requests[0].AssertPayload(t, `{"message-storage-policy":1,"push-type":"LiveActivity"}`)
+	assert.Equal(t, "/4/broadcasts/apps/com.example.app", requests[1].Path)
+	assert.Equal(t, channelID, requests[1].ChannelID)
+	requests[1].AssertHeader(t, "apns-push-type", "liveactivity")
+	requests[1].AssertHeader(t, "apns-topic", "com.example.app.push-type.liveactivity")
+	requests[1].AssertPayload(t, `{"aps":{"event":"update","timestamp":1001,"content-state":{"score":1}}}`)
+}
+
+func TestBroadcastUnknownChannel(t *testing.T) {
+	server := apns2test.NewServer()
+	defer server.Close()
+	client := server.Client().WithDefaultTopic("com.example.app")
+
+	update := liveactivity.NewPayload().Event(liveactivity.EventUpdate).Timestamp(1001).
+		ContentState(map[string]int{"score": 1})
+	res, err := client.Broadcast("dW5rbm93bi1jaGFubmVs", update)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, apns2.ReasonChannelNotRegistered, res.Reason)
+}
+
+func TestPayloadsEqual(t *testing.T) {
+	assert.True(t, apns2test.PayloadsEqual(
+		[]byte(`{"aps":{"event":"update","content-state":{"home":1,"away":0}}}`),
+		[]byte(`{ "aps": { "content-state": { "away": 0, "home": 1 }, "event": "update" } }`)))
+	assert.False(t, apns2test.PayloadsEqual(
+		[]byte(`{"aps":{"event":"update","content-state":{"home":1,"away":0}}}`),
+		[]byte(`{"aps":{"event":"update","content-state":{"home":2,"away":0}}}`)))
+	assert.False(t, apns2test.PayloadsEqual([]byte(`{"aps":{}}`), []byte(`{"aps":{},"extra":true}`)))
+	assert.False(t, apns2test.PayloadsEqual([]byte(`{"aps":`), []byte(`{"aps":`)))
+}
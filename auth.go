@@ -0,0 +1,40 @@
+package apns2
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// certificateClient returns the http.Client used for notifications which
+// authenticate with cert in place of the Client's credentials, creating it on
+// first use. It shares the TLS settings of the Client's own transport, such
+// as root CAs and server pins, but presents cert instead.
+func (c *Client) certificateClient(cert *tls.Certificate) *http.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.certs[cert]; ok {
+		return client
+	}
+	tlsConfig := &tls.Config{}
+	if base := c.tlsConfig(); base != nil {
+		tlsConfig = base.Clone()
+	}
+	tlsConfig.Certificates = []tls.Certificate{*cert}
+	client := &http.Client{
+		Transport: NewTransport(tlsConfig),
+		Timeout:   c.HTTPClient.Timeout,
+	}
+	if c.certs == nil {
+		c.certs = map[*tls.Certificate]*http.Client{}
+	}
+	c.certs[cert] = client
+	return client
+}
+
+func (c *Client) closeCertificateClients() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, client := range c.certs {
+		client.CloseIdleConnections()
+	}
+}
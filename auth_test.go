@@ -0,0 +1,67 @@
+package apns2_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mkc-bill/apns2/certificate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationTokenOverride(t *testing.T) {
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("authorization"))
+	}))
+	defer server.Close()
+	client := mockClient(server.URL)
+	client.Token = mockToken()
+
+	first := mockNotification()
+	first.Token = mockToken()
+	second := mockNotification()
+	second.Token = mockToken()
+	_, err := client.Push(first)
+	assert.NoError(t, err)
+	_, err = client.Push(second)
+	assert.NoError(t, err)
+	_, err = client.Push(mockNotification())
+	assert.NoError(t, err)
+
+	assert.Len(t, authorizations, 3)
+	assert.Equal(t, "bearer "+first.Token.Bearer, authorizations[0])
+	assert.Equal(t, "bearer "+second.Token.Bearer, authorizations[1])
+	assert.Equal(t, "bearer "+client.Token.Bearer, authorizations[2])
+	assert.NotEqual(t, authorizations[0], authorizations[1])
+}
+
+func TestNotificationCertificateOverride(t *testing.T) {
+	crt, _ := certificate.FromP12File("certificate/_fixtures/certificate-valid.p12", "")
+	var presented int
+	var authorization string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented = len(r.TLS.PeerCertificates)
+		authorization = r.Header.Get("authorization")
+	}))
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	client := mockTLSClient(server)
+	client.Token = mockToken()
+	n := mockNotification()
+	n.Certificate = &crt
+	res, err := client.Push(n)
+	assert.NoError(t, err)
+	assert.True(t, res.Sent())
+	assert.Equal(t, 1, presented)
+	assert.Equal(t, "", authorization)
+
+	_, err = client.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, presented)
+	assert.NotEqual(t, "", authorization)
+}
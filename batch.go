@@ -0,0 +1,295 @@
+package apns2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultBatchConcurrency is the number of pushes kept in flight at once by
+// PushMany and PushBatch when BatchOptions.Concurrency is not set.
+var DefaultBatchConcurrency = 16
+
+// DefaultBatchMaxRetries and DefaultBatchBackoff are used when
+// BatchOptions.RetryTransient is set without MaxRetries or Backoff.
+var (
+	DefaultBatchMaxRetries = 3
+	DefaultBatchBackoff    = 500 * time.Millisecond
+)
+
+// ErrBatchStopped is reported for the notifications of a batch which were not
+// sent because BatchOptions.StopOnPermanentError stopped the batch.
+var ErrBatchStopped = errors.New("apns2: batch stopped after a permanent error")
+
+// BatchOptions configures how a batch of notifications is sent. A nil
+// *BatchOptions uses the defaults.
+type BatchOptions struct {
+	// Concurrency is the maximum number of pushes in flight at once. If zero,
+	// DefaultBatchConcurrency is used.
+	Concurrency int
+
+	// RetryTransient retries notifications APNs rejected with a transient
+	// status, 429 or 5xx, leaving permanent failures alone. Each retry waits
+	// for the backoff, which doubles after every attempt.
+	RetryTransient bool
+
+	// MaxRetries is the maximum number of times a notification is retried
+	// when RetryTransient is set. If zero, DefaultBatchMaxRetries is used.
+	MaxRetries int
+
+	// Backoff is the wait before the first retry when RetryTransient is set.
+	// If zero, DefaultBatchBackoff is used.
+	Backoff time.Duration
+
+	// StopOnPermanentError stops the batch as soon as APNs rejects a
+	// notification for a reason which dooms the rest of the batch, such as
+	// BadTopic or InvalidProviderToken. Pushes in flight are cancelled and
+	// those not yet started fail with ErrBatchStopped. Rejections specific to
+	// a device token, such as BadDeviceToken or Unregistered, and transient
+	// failures do not stop the batch.
+	StopOnPermanentError bool
+}
+
+// BatchItem is the outcome of a single push within a batch.
+type BatchItem struct {
+	// The Notification that was sent.
+	Notification *Notification
+
+	// The Response from APNs, or nil if Err is set.
+	Response *Response
+
+	// Any error returned while sending the Notification.
+	Err error
+}
+
+// BatchResult holds the outcome of a batch. Items are in the same order as the
+// notifications or device tokens of the batch.
+type BatchResult struct {
+	Items []BatchItem
+
+	// The number of notifications accepted by APNs.
+	Sent int
+
+	// The number of notifications which were rejected or could not be sent.
+	Failed int
+
+	// The errors for each failed notification, in batch order. Rejections by
+	// APNs are reported as *APNsError.
+	Errors []error
+
+	// The device tokens APNs reported as no longer active for the topic, which
+	// should be removed from your datastore.
+	Unregistered []string
+}
+
+// PushMany sends each of the notifications concurrently. Every Notification
+// is sent with its own headers, such as Priority, Topic and CollapseID, so a
+// batch can mix notifications of different kinds. Failures, including
+// payloads which cannot be marshalled, are reported on the corresponding
+// BatchItem.
+//
+// A warning is logged for each notification which shares its CollapseID,
+// Topic and recipient with an earlier one in the batch, as only one of them
+// will be shown; both are still sent. Use ValidateAll to catch them
+// beforehand.
+func (c *Client) PushMany(ctx Context, notifications []*Notification, opts *BatchOptions) *BatchResult {
+	for i, j := range duplicateCollapseIDs(notifications) {
+		if j >= 0 {
+			c.logf("apns2: notification %d of the batch has the same collapse ID %q and recipient as notification %d and will replace it on the device", i, notifications[i].CollapseID, j)
+		}
+	}
+	return c.sendBatch(ctx, notifications, func(i int) ([]byte, error) {
+		return notifications[i].marshalPayload(c.timestampNow())
+	}, opts)
+}
+
+// PushBatch sends the payload to each of the device tokens under the topic,
+// or the Client's default topic if topic is empty. The payload is marshalled
+// once and the resulting body is reused for every request, so only the device
+// token in the request path varies. The other headers are left at their
+// defaults; use PushMany for notifications which need them.
+//
+// An error is returned only if the payload cannot be marshalled, in which case
+// nothing is sent. Failures for individual tokens are reported on the
+// corresponding BatchItem.
+func (c *Client) PushBatch(ctx Context, topic string, payload Payloader, tokens []string, opts *BatchOptions) (*BatchResult, error) {
+	n := &Notification{Topic: topic, Payload: payload}
+	body, err := n.marshalPayload(c.timestampNow())
+	if err != nil {
+		return nil, err
+	}
+	notifications := make([]*Notification, len(tokens))
+	for i, token := range tokens {
+		m := *n
+		m.DeviceToken = token
+		notifications[i] = &m
+	}
+	return c.sendBatch(ctx, notifications, func(int) ([]byte, error) {
+		return body, nil
+	}, opts), nil
+}
+
+// EstimateBatch reports, without sending anything, the total size in bytes of
+// the payloads of the notifications as they would be sent by the Client, for
+// capacity planning ahead of a large campaign. Each notification is also
+// checked as by ValidateAll, and errs holds the problem with each, in the same
+// order, or is nil if every notification is valid. A payload which cannot be
+// marshalled is reported in errs and left out of the total.
+func (c *Client) EstimateBatch(notifications []*Notification) (totalBytes int, errs []error) {
+	errs = ValidateAll(notifications)
+	now := c.timestampNow()
+	for i, n := range notifications {
+		payload, err := n.marshalPayload(now)
+		if err != nil {
+			if errs == nil {
+				errs = make([]error, len(notifications))
+			}
+			if errs[i] == nil {
+				errs[i] = err
+			}
+			continue
+		}
+		totalBytes += len(payload)
+	}
+	return totalBytes, errs
+}
+
+// sendBatch pushes the notifications concurrently, using body to obtain the
+// marshalled payload for the notification at each index.
+func (c *Client) sendBatch(ctx Context, notifications []*Notification, body func(i int) ([]byte, error), opts *BatchOptions) *BatchResult {
+	result := &BatchResult{Items: make([]BatchItem, len(notifications))}
+	stop := func() {}
+	if opts != nil && opts.StopOnPermanentError {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		stop = cancel
+	}
+	sem := make(chan struct{}, opts.concurrency())
+	var wg sync.WaitGroup
+	for i, n := range notifications {
+		sem <- struct{}{}
+		if stopped(ctx) {
+			<-sem
+			result.Items[i] = BatchItem{Notification: n, Err: ErrBatchStopped}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, n *Notification) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			item := BatchItem{Notification: n}
+			payload, err := body(i)
+			if err == nil {
+				item.Response, item.Err = c.pushWithRetry(ctx, n, payload, opts)
+				if item.Err == nil && dooms(item.Response) {
+					stop()
+				}
+			} else {
+				item.Err = err
+			}
+			result.Items[i] = item
+		}(i, n)
+	}
+	wg.Wait()
+	result.summarize()
+	return result
+}
+
+// pushWithRetry pushes the notification, retrying transient rejections if the
+// options ask for it.
+func (c *Client) pushWithRetry(ctx Context, n *Notification, payload []byte, opts *BatchOptions) (*Response, error) {
+	res, err := c.push(ctx, n, payload)
+	if opts == nil || !opts.RetryTransient {
+		return res, err
+	}
+	backoff := opts.backoff()
+	for attempt := 0; attempt < opts.maxRetries() && err == nil && res.Retriable(); attempt++ {
+		if !wait(ctx, backoff) {
+			break
+		}
+		backoff *= 2
+		res, err = c.push(ctx, n, payload)
+	}
+	return res, err
+}
+
+// dooms reports whether a rejection is caused by the configuration shared by
+// the whole batch, such as its topic or credentials, rather than by a single
+// device token, so that every other notification would be rejected too.
+func dooms(res *Response) bool {
+	switch res.Reason {
+	case ReasonBadTopic, ReasonTopicDisallowed, ReasonMissingTopic, ReasonInvalidPushType,
+		ReasonBadCertificate, ReasonBadCertificateEnvironment, ReasonForbidden,
+		ReasonInvalidProviderToken, ReasonMissingProviderToken, ReasonBadPath:
+		return true
+	}
+	return false
+}
+
+// stopped reports whether ctx has been cancelled.
+func stopped(ctx Context) bool {
+	return ctx != nil && ctx.Err() != nil
+}
+
+// wait sleeps for d, returning false early if ctx is done first.
+func wait(ctx Context, d time.Duration) bool {
+	if ctx == nil {
+		time.Sleep(d)
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (r *BatchResult) summarize() {
+	for _, item := range r.Items {
+		switch {
+		case item.Err != nil:
+			r.Failed++
+			r.Errors = append(r.Errors, item.Err)
+		case item.Response.Sent():
+			r.Sent++
+		default:
+			r.Failed++
+			r.Errors = append(r.Errors, item.Response.Err())
+			if item.Response.StatusCode == http.StatusGone {
+				r.Unregistered = append(r.Unregistered, item.Notification.DeviceToken)
+			}
+		}
+	}
+}
+
+func (o *BatchOptions) concurrency() int {
+	if o == nil || o.Concurrency <= 0 {
+		return DefaultBatchConcurrency
+	}
+	return o.Concurrency
+}
+
+func (o *BatchOptions) maxRetries() int {
+	if o.MaxRetries <= 0 {
+		return DefaultBatchMaxRetries
+	}
+	return o.MaxRetries
+}
+
+func (o *BatchOptions) backoff() time.Duration {
+	if o.Backoff <= 0 {
+		return DefaultBatchBackoff
+	}
+	return o.Backoff
+}
@@ -0,0 +1,315 @@
+package apns2_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apns "github.com/mkc-bill/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingPayload struct {
+	marshalled int32
+}
+
+func (p *countingPayload) MarshalJSON() ([]byte, error) {
+	atomic.AddInt32(&p.marshalled, 1)
+	return []byte(`{"aps":{"alert":"Hello!"}}`), nil
+}
+
+var batchTokens = []string{
+	"11aa01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7",
+	"22bb01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7",
+	"33cc01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7",
+}
+
+func TestPushBatchMarshalsOnce(t *testing.T) {
+	var mu sync.Mutex
+	paths := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, `{"aps":{"alert":"Hello!"}}`, string(body))
+		assert.Equal(t, "com.testapp", r.Header.Get("apns-topic"))
+		mu.Lock()
+		paths[r.URL.Path] = true
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	payload := &countingPayload{}
+	res, err := mockClient(server.URL).PushBatch(context.Background(), "com.testapp", payload, batchTokens, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), payload.marshalled)
+	assert.Len(t, res.Items, len(batchTokens))
+	for i, item := range res.Items {
+		assert.NoError(t, item.Err)
+		assert.True(t, item.Response.Sent())
+		assert.Equal(t, batchTokens[i], item.Notification.DeviceToken)
+		assert.True(t, paths["/3/device/"+batchTokens[i]])
+	}
+}
+
+func TestPushBatchConcurrency(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cur := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if cur <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, cur) {
+				break
+			}
+		}
+		atomic.AddInt32(&inFlight, -1)
+	}))
+	defer server.Close()
+
+	tokens := strings.Split(strings.Repeat("aa,", 20), ",")[:20]
+	_, err := mockClient(server.URL).PushBatch(context.Background(), "", &countingPayload{}, tokens, &apns.BatchOptions{Concurrency: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), maxInFlight)
+}
+
+func TestPushBatchBadPayload(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	payload := &failingBatchPayload{}
+	res, err := mockClient(server.URL).PushBatch(context.Background(), "com.testapp", payload, batchTokens, nil)
+	assert.True(t, errors.Is(err, apns.ErrInvalidPayload))
+	assert.Nil(t, res)
+	assert.Equal(t, int32(1), payload.marshalled)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+type failingBatchPayload struct {
+	marshalled int32
+}
+
+func (p *failingBatchPayload) MarshalJSON() ([]byte, error) {
+	atomic.AddInt32(&p.marshalled, 1)
+	return nil, apns.ErrInvalidPayload
+}
+
+func TestPushManyPerNotificationHeaders(t *testing.T) {
+	var mu sync.Mutex
+	priorities := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		priorities[r.URL.Path] = r.Header.Get("apns-priority")
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	notifications := []*apns.Notification{
+		{DeviceToken: batchTokens[0], Priority: apns.PriorityHigh, Payload: []byte(`{"aps":{}}`)},
+		{DeviceToken: batchTokens[1], Priority: apns.PriorityLow, Payload: []byte(`{"aps":{}}`)},
+		{DeviceToken: batchTokens[2], Payload: []byte(`{"aps":{}}`)},
+	}
+	res := mockClient(server.URL).PushMany(context.Background(), notifications, nil)
+	assert.Len(t, res.Items, 3)
+	for i, item := range res.Items {
+		assert.NoError(t, item.Err)
+		assert.Equal(t, notifications[i], item.Notification)
+	}
+	assert.Equal(t, "10", priorities["/3/device/"+batchTokens[0]])
+	assert.Equal(t, "5", priorities["/3/device/"+batchTokens[1]])
+	assert.Equal(t, "", priorities["/3/device/"+batchTokens[2]])
+}
+
+func TestPushManyBadPayload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	bad := mockNotification()
+	bad.Payload = func() {}
+	res := mockClient(server.URL).PushMany(context.Background(), []*apns.Notification{mockNotification(), bad}, nil)
+	assert.NoError(t, res.Items[0].Err)
+	assert.Error(t, res.Items[1].Err)
+	assert.Nil(t, res.Items[1].Response)
+}
+
+func TestBatchResultSummary(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/3/device/" + batchTokens[1]:
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason":"Unregistered","timestamp":1458114061260}`))
+		case "/3/device/" + batchTokens[2]:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason":"BadDeviceToken"}`))
+		}
+	}))
+	defer server.Close()
+
+	bad := mockNotification()
+	bad.Payload = func() {}
+	notifications := []*apns.Notification{
+		{DeviceToken: batchTokens[0], Payload: []byte(`{"aps":{}}`)},
+		{DeviceToken: batchTokens[1], Payload: []byte(`{"aps":{}}`)},
+		{DeviceToken: batchTokens[2], Payload: []byte(`{"aps":{}}`)},
+		bad,
+	}
+	res := mockClient(server.URL).PushMany(context.Background(), notifications, nil)
+	assert.Equal(t, 1, res.Sent)
+	assert.Equal(t, 3, res.Failed)
+	assert.Len(t, res.Errors, 3)
+	assert.Equal(t, []string{batchTokens[1]}, res.Unregistered)
+
+	var apnsErr *apns.APNsError
+	assert.True(t, errors.As(res.Errors[0], &apnsErr))
+	assert.Equal(t, apns.ReasonUnregistered, apnsErr.Reason)
+	assert.True(t, errors.As(res.Errors[1], &apnsErr))
+	assert.Equal(t, apns.ReasonBadDeviceToken, apnsErr.Reason)
+	assert.False(t, errors.As(res.Errors[2], &apnsErr))
+}
+
+func TestPushManyRetryTransient(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts[r.URL.Path]++
+		attempt := attempts[r.URL.Path]
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/3/device/" + batchTokens[0]:
+			if attempt == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"reason":"TooManyRequests"}`))
+			}
+		case "/3/device/" + batchTokens[1]:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason":"BadDeviceToken"}`))
+		case "/3/device/" + batchTokens[2]:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	notifications := []*apns.Notification{
+		{DeviceToken: batchTokens[0], Payload: []byte(`{"aps":{}}`)},
+		{DeviceToken: batchTokens[1], Payload: []byte(`{"aps":{}}`)},
+		{DeviceToken: batchTokens[2], Payload: []byte(`{"aps":{}}`)},
+	}
+	opts := &apns.BatchOptions{RetryTransient: true, MaxRetries: 2, Backoff: time.Millisecond}
+	res := mockClient(server.URL).PushMany(context.Background(), notifications, opts)
+
+	assert.True(t, res.Items[0].Response.Sent())
+	assert.Equal(t, http.StatusBadRequest, res.Items[1].Response.StatusCode)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Items[2].Response.StatusCode)
+	assert.Equal(t, 2, attempts["/3/device/"+batchTokens[0]])
+	assert.Equal(t, 1, attempts["/3/device/"+batchTokens[1]])
+	assert.Equal(t, 3, attempts["/3/device/"+batchTokens[2]])
+}
+
+func TestPushManyNoRetryByDefault(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	res := mockClient(server.URL).PushMany(context.Background(), []*apns.Notification{mockNotification()}, nil)
+	assert.Equal(t, http.StatusTooManyRequests, res.Items[0].Response.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestPushManyStopOnPermanentError(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"reason":"BadTopic"}`))
+	}))
+	defer server.Close()
+
+	notifications := make([]*apns.Notification, 10)
+	for i := range notifications {
+		notifications[i] = mockNotification()
+	}
+	opts := &apns.BatchOptions{Concurrency: 1, StopOnPermanentError: true}
+	res := mockClient(server.URL).PushMany(context.Background(), notifications, opts)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, apns.ReasonBadTopic, res.Items[0].Response.Reason)
+	for _, item := range res.Items[1:] {
+		assert.Equal(t, apns.ErrBatchStopped, item.Err)
+	}
+	assert.Equal(t, 10, res.Failed)
+}
+
+func TestPushManyStopOnPermanentErrorIgnoresTokenErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason":"BadDeviceToken"}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"reason":"ServiceUnavailable"}`))
+	}))
+	defer server.Close()
+
+	notifications := []*apns.Notification{mockNotification(), mockNotification(), mockNotification()}
+	opts := &apns.BatchOptions{Concurrency: 1, StopOnPermanentError: true}
+	res := mockClient(server.URL).PushMany(context.Background(), notifications, opts)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	for _, item := range res.Items {
+		assert.NoError(t, item.Err)
+	}
+}
+
+func TestPushManyWarnsDuplicateCollapseID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	var buf bytes.Buffer
+	client := mockClient(server.URL).WithLogger(log.New(&buf, "", 0))
+
+	notifications := []*apns.Notification{
+		{DeviceToken: batchTokens[0], CollapseID: "score", Payload: []byte(`{"aps":{}}`)},
+		{DeviceToken: batchTokens[1], CollapseID: "score", Payload: []byte(`{"aps":{}}`)},
+		{DeviceToken: batchTokens[0], CollapseID: "score", Payload: []byte(`{"aps":{}}`)},
+	}
+	res := client.PushMany(context.Background(), notifications, nil)
+	assert.Equal(t, 3, res.Sent)
+	assert.Equal(t, "apns2: notification 2 of the batch has the same collapse ID \"score\" and recipient as notification 0 and will replace it on the device\n", buf.String())
+}
+
+func TestEstimateBatch(t *testing.T) {
+	total, errs := mockClient("").EstimateBatch([]*apns.Notification{
+		{Topic: "com.testapp", Payload: []byte(`{"aps":{"alert":"Hello!"}}`)},
+		{Topic: "com.testapp", Payload: []byte(`{"aps":{"alert":"Goodbye!"}}`)},
+	})
+	assert.Equal(t, len(`{"aps":{"alert":"Hello!"}}`)+len(`{"aps":{"alert":"Goodbye!"}}`), total)
+	assert.Nil(t, errs)
+}
+
+func TestEstimateBatchErrors(t *testing.T) {
+	total, errs := mockClient("").EstimateBatch([]*apns.Notification{
+		{Topic: "com.testapp", Payload: []byte(`{"aps":{"alert":"Hello!"}}`)},
+		{Topic: "com.testapp", Payload: &failingBatchPayload{}},
+		{Topic: "not a topic", Payload: []byte(`{}`)},
+		{Topic: "com.testapp", Payload: []byte(`{"aps":`)},
+	})
+	assert.Equal(t, len(`{"aps":{"alert":"Hello!"}}`)+len(`{}`), total)
+	assert.Len(t, errs, 4)
+	assert.NoError(t, errs[0])
+	assert.True(t, errors.Is(errs[1], apns.ErrInvalidPayload))
+	assert.Equal(t, apns.ErrInvalidTopic, errs[2])
+	assert.Equal(t, apns.ErrInvalidPayload, errs[3])
+}
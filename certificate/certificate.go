@@ -21,6 +21,7 @@ var (
 	ErrFailedToParseCertificate = errors.New("failed to parse certificate PEM data")
 	ErrNoPrivateKey             = errors.New("no private key")
 	ErrNoCertificate            = errors.New("no certificate")
+	ErrKeyMismatch              = errors.New("private key does not match certificate")
 )
 
 // FromP12File loads a PKCS#12 certificate from a local file and returns a
@@ -46,6 +47,9 @@ func FromP12Bytes(bytes []byte, password string) (tls.Certificate, error) {
 	if err != nil {
 		return tls.Certificate{}, err
 	}
+	if !keyMatches(key, cert) {
+		return tls.Certificate{}, ErrKeyMismatch
+	}
 	return tls.Certificate{
 		Certificate: [][]byte{cert.Raw},
 		PrivateKey:  key,
@@ -103,11 +107,29 @@ func FromPemBytes(bytes []byte, password string) (tls.Certificate, error) {
 		return tls.Certificate{}, ErrNoPrivateKey
 	}
 	if c, e := x509.ParseCertificate(cert.Certificate[0]); e == nil {
+		if !keyMatches(cert.PrivateKey, c) {
+			return tls.Certificate{}, ErrKeyMismatch
+		}
 		cert.Leaf = c
 	}
 	return cert, nil
 }
 
+// keyMatches reports whether the private key corresponds to the public key of
+// the certificate. Keys of a type which cannot be compared are assumed to
+// match, leaving the TLS handshake to reject them.
+func keyMatches(key crypto.PrivateKey, cert *x509.Certificate) bool {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return true
+	}
+	public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return true
+	}
+	return public.Equal(cert.PublicKey)
+}
+
 func unencryptPrivateKey(block *pem.Block, password string) (crypto.PrivateKey, error) {
 	if x509.IsEncryptedPEMBlock(block) {
 		bytes, err := x509.DecryptPEMBlock(block, []byte(password))
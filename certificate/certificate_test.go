@@ -106,3 +106,9 @@ func TestNoCertificatePemFile(t *testing.T) {
 	assert.Equal(t, tls.Certificate{}, cer)
 	assert.Equal(t, certificate.ErrNoCertificate, err)
 }
+
+func TestMismatchedKeyPemFile(t *testing.T) {
+	cer, err := certificate.FromPemFile("_fixtures/certificate-mismatched-key.pem", "")
+	assert.Equal(t, certificate.ErrKeyMismatch, err)
+	assert.Equal(t, tls.Certificate{}, cer)
+}
@@ -0,0 +1,56 @@
+package apns2
+
+import (
+	"crypto/tls"
+	"strings"
+	"sync"
+)
+
+// CertStore holds the certificates of several apps, keyed by topic, for
+// services which send to more than one bundle ID with certificate based
+// authentication. It is safe for concurrent use.
+type CertStore struct {
+	mu    sync.RWMutex
+	certs map[string]*tls.Certificate
+}
+
+// NewCertStore returns an empty CertStore.
+func NewCertStore() *CertStore {
+	return &CertStore{certs: map[string]*tls.Certificate{}}
+}
+
+// Add stores the certificate to use for topic, typically a bundle ID,
+// replacing any certificate already stored for it.
+func (s *CertStore) Add(topic string, cert tls.Certificate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.certs[topic] = &cert
+}
+
+// Get returns the certificate for topic. If none was added for the topic
+// itself, the certificate of the longest topic it extends is returned, so
+// that the certificate of a bundle ID is also used for its suffixed topics,
+// such as "com.example.app.voip".
+func (s *CertStore) Get(topic string) (*tls.Certificate, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for {
+		if cert, ok := s.certs[topic]; ok {
+			return cert, true
+		}
+		i := strings.LastIndex(topic, ".")
+		if i < 0 {
+			return nil, false
+		}
+		topic = topic[:i]
+	}
+}
+
+// WithCertStore makes the Client authenticate each notification with the
+// certificate stored for its topic, falling back to the Client's own
+// credentials for topics without one. A Token or Certificate set on the
+// notification itself takes precedence.
+func (c *Client) WithCertStore(store *CertStore) *Client {
+	c.certStore = store
+	return c
+}
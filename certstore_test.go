@@ -0,0 +1,77 @@
+package apns2_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	apns "github.com/mkc-bill/apns2"
+	"github.com/mkc-bill/apns2/certificate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertStoreGet(t *testing.T) {
+	store := apns.NewCertStore()
+	store.Add("com.example.app", mockCert())
+
+	_, ok := store.Get("com.example.app")
+	assert.True(t, ok)
+	_, ok = store.Get("com.example.app.voip")
+	assert.True(t, ok)
+	_, ok = store.Get("com.example.other")
+	assert.False(t, ok)
+}
+
+func TestCertStoreSelectsByTopic(t *testing.T) {
+	certA, _ := certificate.FromP12File("certificate/_fixtures/certificate-valid.p12", "")
+	certB := selfSignedCert(t)
+
+	var mu sync.Mutex
+	presented := map[string][]byte{}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		presented[r.Header.Get("apns-topic")] = r.TLS.PeerCertificates[0].Raw
+	}))
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	store := apns.NewCertStore()
+	store.Add("com.example.a", certA)
+	store.Add("com.example.b", certB)
+	client := mockTLSClient(server).WithCertStore(store)
+
+	for _, topic := range []string{"com.example.a", "com.example.b"} {
+		n := mockNotification()
+		n.Topic = topic
+		_, err := client.Push(n)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, certA.Certificate[0], presented["com.example.a"])
+	assert.Equal(t, certB.Certificate[0], presented["com.example.b"])
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Apple Push Services: com.example.b"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
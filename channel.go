@@ -0,0 +1,95 @@
+package apns2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Apple broadcast channel management urls, used by CreateChannel.
+const (
+	ManageHostDevelopment = "https://api-manage-broadcast.sandbox.push.apple.com:2195"
+	ManageHostProduction  = "https://api-manage-broadcast.push.apple.com:2196"
+)
+
+// ErrNoDefaultTopic is returned by CreateChannel and Broadcast when the
+// Client has no default topic to identify the app by.
+var ErrNoDefaultTopic = errors.New("apns2: no default topic, call WithDefaultTopic with the app's bundle ID")
+
+// CreateChannel creates a broadcast channel for Live Activities of the app
+// whose bundle ID is the Client's default topic, with the message storage
+// policy StoragePolicyNone or StoragePolicyMostRecent. It returns the ID of
+// the new channel, which should be stored and used with Broadcast, and passed
+// to the app so Live Activities can subscribe to it.
+//
+// The request is sent to the Client's ManageHost, or if that is not set, to
+// ManageHostProduction when Host is HostProduction and to
+// ManageHostDevelopment otherwise. A rejection is returned as an *APNsError.
+func (c *Client) CreateChannel(ctx Context, storagePolicy int) (string, error) {
+	bundleID := strings.TrimSuffix(c.topic, LiveActivityTopicSuffix)
+	if bundleID == "" {
+		return "", ErrNoDefaultTopic
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"message-storage-policy": storagePolicy,
+		"push-type":              "LiveActivity",
+	})
+	if err != nil {
+		return "", err
+	}
+	url := c.manageHost() + "/1/apps/" + bundleID + "/channels"
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	if c.Token != nil {
+		setTokenHeader(request, c.Token)
+	}
+	request.Header.Set("Content-Type", "application/json; charset=utf-8")
+	request.Header.Set("User-Agent", c.userAgentHeader())
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return "", &NetworkError{Err: err}
+	}
+	defer response.Body.Close()
+	r := &Response{StatusCode: response.StatusCode, ApnsID: response.Header.Get("apns-request-id")}
+	if response.StatusCode != http.StatusCreated {
+		r.RawBody, _ = ioutil.ReadAll(response.Body)
+		if err := r.decodeBody(); err != nil {
+			return "", err
+		}
+		return "", &APNsError{StatusCode: r.StatusCode, Reason: r.Reason, ApnsID: r.ApnsID}
+	}
+	return response.Header.Get("apns-channel-id"), nil
+}
+
+// Broadcast sends the Live Activity payload p to every device subscribed to
+// the broadcast channel, such as one returned by CreateChannel, for the app
+// whose bundle ID is the Client's default topic. It is a shorthand for
+// pushing a Notification with the ChannelID and the liveactivity PushType.
+func (c *Client) Broadcast(channelID string, p Payloader) (*Response, error) {
+	if c.topic == "" {
+		return nil, ErrNoDefaultTopic
+	}
+	return c.PushWithContext(context.Background(), &Notification{
+		ChannelID: channelID,
+		PushType:  LiveActivity,
+		Payload:   p,
+	})
+}
+
+// manageHost returns the base URL of the channel management API.
+func (c *Client) manageHost() string {
+	if c.ManageHost != "" {
+		return c.ManageHost
+	}
+	if c.Host == HostProduction {
+		return ManageHostProduction
+	}
+	return ManageHostDevelopment
+}
@@ -0,0 +1,64 @@
+package apns2_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apns "github.com/mkc-bill/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateChannelNoDefaultTopic(t *testing.T) {
+	_, err := mockClient("").CreateChannel(context.Background(), apns.StoragePolicyNone)
+	assert.Equal(t, apns.ErrNoDefaultTopic, err)
+	_, err = mockClient("").Broadcast("dHN0LXNyY2gtY2hubA==", json.RawMessage(`{"aps":{}}`))
+	assert.Equal(t, apns.ErrNoDefaultTopic, err)
+}
+
+func TestCreateChannelRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/1/apps/com.testapp/channels", r.URL.Path)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"reason":"InvalidProviderToken"}`))
+	}))
+	defer server.Close()
+	client := mockClient(server.URL).WithDefaultTopic("com.testapp" + apns.LiveActivityTopicSuffix)
+	client.ManageHost = server.URL
+
+	channelID, err := client.CreateChannel(context.Background(), apns.StoragePolicyNone)
+	assert.Equal(t, "", channelID)
+	var apnsErr *apns.APNsError
+	assert.True(t, errors.As(err, &apnsErr))
+	assert.Equal(t, apns.ReasonInvalidProviderToken, apnsErr.Reason)
+}
+
+func TestManageHost(t *testing.T) {
+	transport := &hostTransport{}
+	client := &apns.Client{HTTPClient: &http.Client{Transport: transport}}
+	client.WithDefaultTopic("com.testapp")
+	client.Production().CreateChannel(context.Background(), apns.StoragePolicyNone)
+	client.Development().CreateChannel(context.Background(), apns.StoragePolicyNone)
+	assert.Equal(t, []string{apns.ManageHostProduction, apns.ManageHostDevelopment}, transport.hosts)
+}
+
+func TestBroadcastWithDedup(t *testing.T) {
+	var channels []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		channels = append(channels, r.Header.Get("apns-channel-id"))
+	}))
+	defer server.Close()
+	client := mockClient(server.URL).WithDefaultTopic("com.testapp").WithDedup(time.Minute)
+
+	update := json.RawMessage(`{"aps":{"event":"update","timestamp":1,"content-state":{"score":1}}}`)
+	for _, channelID := range []string{"dGVhbS1h", "dGVhbS1i", "dGVhbS1h"} {
+		res, err := client.Broadcast(channelID, update)
+		assert.NoError(t, err)
+		assert.True(t, res.Sent())
+	}
+	assert.Equal(t, []string{"dGVhbS1h", "dGVhbS1i"}, channels)
+}
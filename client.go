@@ -6,12 +6,16 @@ package apns2
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
-	"encoding/json"
-	"io"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/mkc-bill/apns2/token"
@@ -27,6 +31,13 @@ const (
 // DefaultHost is a mutable var for testing purposes
 var DefaultHost = HostDevelopment
 
+// Version is the version of this package.
+const Version = "0.1.0"
+
+// DefaultUserAgent is the User-Agent header sent with each request unless one
+// is set with WithUserAgent.
+var DefaultUserAgent = "apns2/" + Version
+
 var (
 	// HTTPClientTimeout specifies a time limit for requests made by the
 	// HTTPClient. The timeout includes connection time, any redirects,
@@ -48,6 +59,18 @@ var (
 	TLSDialTimeout = 20 * time.Second
 )
 
+// ErrServerPinMismatch is returned during the TLS handshake when none of the
+// certificates presented by the server match a pin set with WithServerPins.
+var ErrServerPinMismatch = errors.New("apns2: server certificate does not match any pinned public key")
+
+// ErrClientShutdown is returned when a push is attempted after Shutdown has
+// been called on the Client.
+var ErrClientShutdown = errors.New("apns2: client is shut down")
+
+// ErrMissingUniqueID is returned by a Client set with RequireUniqueID when
+// APNs accepts a notification without returning an apns-unique-id.
+var ErrMissingUniqueID = errors.New("apns2: accepted notification has no apns-unique-id")
+
 // DialTLS is the default dial function for creating TLS connections for
 // non-proxied HTTPS requests.
 var DialTLS = func(network, addr string, cfg *tls.Config) (net.Conn, error) {
@@ -58,12 +81,47 @@ var DialTLS = func(network, addr string, cfg *tls.Config) (net.Conn, error) {
 	return tls.DialWithDialer(dialer, network, addr, cfg)
 }
 
+// Logger is used by the Client to report warnings about likely
+// misconfiguration. *log.Logger satisfies this interface.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
 // Client represents a connection with the APNs
 type Client struct {
 	Host        string
+	ManageHost  string
 	Certificate tls.Certificate
 	Token       *token.Token
 	HTTPClient  *http.Client
+
+	userAgent   string
+	logger      Logger
+	noKeepAlive bool
+	clockSkew   time.Duration
+	clock       Clock
+	environment string
+	requiredEnv string
+	requireUID  bool
+	topic       string
+	expireAfter time.Duration
+	streams     chan struct{}
+	onInvalid   func(token string, reason string)
+	certStore   *CertStore
+
+	connFailures int
+	idleTimeout  time.Duration
+
+	mu       sync.Mutex
+	shutdown bool
+	inFlight sync.WaitGroup
+	dedupTTL time.Duration
+	dedup    map[string]dedupEntry
+	certs    map[*tls.Certificate]*http.Client
+	updates  *updateMonitor
+	channels *channelLimiter
+	lastErrs map[string]error
+	lastUse  time.Time
 }
 
 // A Context carries a deadline, a cancellation signal, and other values across
@@ -95,19 +153,9 @@ func NewClient(certificate tls.Certificate) *Client {
 	if len(certificate.Certificate) > 0 {
 		tlsConfig.BuildNameToCertificate()
 	}
-	transport := &http2.Transport{
-		TLSClientConfig: tlsConfig,
-		DialTLS:         DialTLS,
-		ReadIdleTimeout: ReadIdleTimeout,
-	}
-	return &Client{
-		HTTPClient: &http.Client{
-			Transport: transport,
-			Timeout:   HTTPClientTimeout,
-		},
-		Certificate: certificate,
-		Host:        DefaultHost,
-	}
+	client := NewClientWithTransport(NewTransport(tlsConfig))
+	client.Certificate = certificate
+	return client
 }
 
 // NewTokenClient returns a new Client with an underlying http.Client configured
@@ -119,12 +167,34 @@ func NewClient(certificate tls.Certificate) *Client {
 // notifications; don’t repeatedly open and close connections. APNs treats rapid
 // connection and disconnection as a denial-of-service attack.
 func NewTokenClient(token *token.Token) *Client {
-	transport := &http2.Transport{
+	client := NewClientWithTransport(NewTransport(nil))
+	client.Token = token
+	return client
+}
+
+// NewTransport returns a new HTTP/2 transport configured with the correct
+// APNs settings, using the given TLS configuration, which may be nil.
+//
+// A transport pools its connections by host, so it can be shared between
+// several Clients using NewClientWithTransport to reuse connections at scale.
+// As the TLS configuration belongs to the transport, sharing is best suited
+// to token based Clients; Clients using different certificates need their
+// own transport.
+func NewTransport(tlsConfig *tls.Config) *http2.Transport {
+	return &http2.Transport{
+		TLSClientConfig: tlsConfig,
 		DialTLS:         DialTLS,
 		ReadIdleTimeout: ReadIdleTimeout,
 	}
+}
+
+// NewClientWithTransport returns a new Client which sends notifications
+// using the given transport, typically one created with NewTransport and
+// shared with other Clients. Set the Client's Token to authenticate with a
+// provider token. It does not connect to the APNs until the first
+// Notification is sent via the Push method.
+func NewClientWithTransport(transport *http2.Transport) *Client {
 	return &Client{
-		Token: token,
 		HTTPClient: &http.Client{
 			Transport: transport,
 			Timeout:   HTTPClientTimeout,
@@ -136,12 +206,190 @@ func NewTokenClient(token *token.Token) *Client {
 // Development sets the Client to use the APNs development push endpoint.
 func (c *Client) Development() *Client {
 	c.Host = HostDevelopment
+	c.environment = EnvironmentDevelopment
 	return c
 }
 
 // Production sets the Client to use the APNs production push endpoint.
 func (c *Client) Production() *Client {
 	c.Host = HostProduction
+	c.environment = EnvironmentProduction
+	return c
+}
+
+// WithUserAgent sets the User-Agent header sent with each request, which
+// can be used to identify your service in logs kept by Apple and any
+// intermediaries. If unset, DefaultUserAgent is used.
+func (c *Client) WithUserAgent(userAgent string) *Client {
+	c.userAgent = userAgent
+	return c
+}
+
+// WithDefaultTopic sets the topic used for notifications which leave Topic
+// empty, typically the bundle ID of your app. For notifications with the
+// LiveActivity push type, LiveActivityTopicSuffix is appended to it. A
+// notification's own Topic takes precedence.
+func (c *Client) WithDefaultTopic(topic string) *Client {
+	c.topic = topic
+	return c
+}
+
+// WithDefaultExpiration makes notifications which set neither Expiration nor
+// ExpireAfter expire d after they are pushed, computed each time one is sent.
+// A notification's own expiration takes precedence.
+func (c *Client) WithDefaultExpiration(d time.Duration) *Client {
+	c.expireAfter = d
+	return c
+}
+
+// WithLogger sets the Logger the Client reports warnings to. By default
+// warnings are discarded.
+func (c *Client) WithLogger(logger Logger) *Client {
+	c.logger = logger
+	return c
+}
+
+// WithLocalAddr makes the Client dial APNs from the given local address,
+// which on multi-homed hosts selects the interface APNs traffic egresses from.
+// The address is typically a *net.TCPAddr with a zero port.
+func (c *Client) WithLocalAddr(addr net.Addr) *Client {
+	switch t := c.HTTPClient.Transport.(type) {
+	case *http2.Transport:
+		t.DialTLS = func(network, address string, cfg *tls.Config) (net.Conn, error) {
+			dialer := &net.Dialer{
+				Timeout:   TLSDialTimeout,
+				KeepAlive: TCPKeepAlive,
+				LocalAddr: addr,
+			}
+			return tls.DialWithDialer(dialer, network, address, cfg)
+		}
+	case *http.Transport:
+		dialer := &net.Dialer{
+			Timeout:   TLSDialTimeout,
+			KeepAlive: TCPKeepAlive,
+			LocalAddr: addr,
+		}
+		t.DialContext = dialer.DialContext
+	}
+	return c
+}
+
+// WithoutKeepAlive makes the Client open a new connection for every push
+// and close it once the response is received, rather than reusing
+// connections. This is a diagnostic aid for isolating connection problems;
+// it should not be used in production, as APNs treats rapid connection and
+// disconnection as a denial-of-service attack.
+func (c *Client) WithoutKeepAlive() *Client {
+	c.noKeepAlive = true
+	return c
+}
+
+// RequireUniqueID makes a push which APNs accepts without an apns-unique-id
+// response header fail with ErrMissingUniqueID, for services which must be
+// able to audit every delivered notification. The Response is still
+// returned alongside the error.
+func (c *Client) RequireUniqueID() *Client {
+	c.requireUID = true
+	return c
+}
+
+// WithServerPins pins the public keys the Client accepts from the APNs server.
+// Each pin is the SHA-256 hash of a DER encoded SubjectPublicKeyInfo. The TLS
+// handshake fails with ErrServerPinMismatch unless at least one certificate
+// in the chain presented by the server matches one of the pins. This is in
+// addition to the regular certificate verification.
+func (c *Client) WithServerPins(pins ...[]byte) *Client {
+	if cfg := c.tlsConfig(); cfg != nil {
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			for _, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+				for _, pin := range pins {
+					if bytes.Equal(sum[:], pin) {
+						return nil
+					}
+				}
+			}
+			return ErrServerPinMismatch
+		}
+	}
+	return c
+}
+
+// WithMaxConcurrentStreams limits the Client to n pushes in flight at once,
+// and makes the transport honour the concurrent stream limit advertised by
+// APNs on each connection rather than opening further connections when it is
+// reached. Lower values improve latency at the expense of throughput. The
+// vendored HTTP/2 transport has no setting for the number of streams itself,
+// so the limit is enforced by the Client across all of its connections. A
+// push waiting for one of the n slots gives up when its context is done. An n
+// of zero removes the limit.
+func (c *Client) WithMaxConcurrentStreams(n uint32) *Client {
+	var streams chan struct{}
+	if n > 0 {
+		if t, ok := c.HTTPClient.Transport.(*http2.Transport); ok {
+			t.StrictMaxConcurrentStreams = true
+		}
+		streams = make(chan struct{}, n)
+	}
+	c.mu.Lock()
+	c.streams = streams
+	c.mu.Unlock()
+	return c
+}
+
+// OnInvalidToken registers fn to be called whenever APNs rejects a push
+// because its device token is bad, unregistered or expired, with the device
+// token and the reason, so that it can be removed from your datastore. fn is
+// called synchronously before the push returns, so it should be quick or hand
+// the work off.
+func (c *Client) OnInvalidToken(fn func(token string, reason string)) *Client {
+	c.onInvalid = fn
+	return c
+}
+
+// TokenStore is implemented by the datastore of device tokens a Client
+// removes invalid tokens from when set with WithTokenStore.
+type TokenStore interface {
+	Remove(token string)
+}
+
+// WithTokenStore makes the Client remove a device token from s whenever APNs
+// rejects a push to it because it is bad, unregistered or expired, as
+// reported to OnInvalidToken. It replaces any function registered with
+// OnInvalidToken, and is replaced by a later one. Remove is called
+// synchronously before the push returns.
+func (c *Client) WithTokenStore(s TokenStore) *Client {
+	return c.OnInvalidToken(func(token string, reason string) {
+		s.Remove(token)
+	})
+}
+
+// WithSessionCache sets the cache the Client uses to resume TLS sessions, so
+// that reconnecting to APNs can skip a full handshake. If cache is nil an LRU
+// cache of the default capacity is used.
+func (c *Client) WithSessionCache(cache tls.ClientSessionCache) *Client {
+	if cache == nil {
+		cache = tls.NewLRUClientSessionCache(0)
+	}
+	if cfg := c.tlsConfig(); cfg != nil {
+		cfg.ClientSessionCache = cache
+	}
+	return c
+}
+
+// WithRootCAs makes the Client verify the APNs server certificate against
+// the certificate authorities in pool instead of the system pool, for example
+// to reach a local mock server or to pass through a TLS-intercepting proxy
+// whose CA is not installed on the system. A nil pool restores the system
+// pool.
+func (c *Client) WithRootCAs(pool *x509.CertPool) *Client {
+	if cfg := c.tlsConfig(); cfg != nil {
+		cfg.RootCAs = pool
+	}
 	return c
 }
 
@@ -166,39 +414,271 @@ func (c *Client) Push(n *Notification) (*Response, error) {
 // return a Response indicating whether the notification was accepted or
 // rejected by the APNs gateway, or an error if something goes wrong.
 func (c *Client) PushWithContext(ctx Context, n *Notification) (*Response, error) {
-	payload, err := json.Marshal(n)
+	payload, err := n.marshalPayload(c.timestampNow())
 	if err != nil {
 		return nil, err
 	}
+	return c.push(ctx, n, payload)
+}
 
-	url := c.Host + "/3/device/" + n.DeviceToken
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
-	if err != nil {
+// push sends the notification with the marshalled payload. If APNs rejects
+// the provider token as expired, perhaps because the host was suspended past
+// its lifetime, the token is regenerated and the request made once more.
+func (c *Client) push(ctx Context, n *Notification, payload []byte) (*Response, error) {
+	if err := c.checkEnvironment(); err != nil {
 		return nil, err
 	}
+	c.mu.Lock()
+	if c.shutdown {
+		c.mu.Unlock()
+		return nil, ErrClientShutdown
+	}
+	c.inFlight.Add(1)
+	dedup := c.dedupTTL > 0
+	streams := c.streams
+	c.mu.Unlock()
+	defer c.inFlight.Done()
 
-	if c.Token != nil {
-		c.setTokenHeader(request)
+	n = c.withDefaults(n)
+
+	var key string
+	if dedup {
+		key = dedupKey(n, payload)
+		if res, ok := c.dedupLookup(key); ok {
+			return res, nil
+		}
+	}
+
+	// A push still in flight when the notification expires is pointless, so
+	// give up on it then rather than waiting for the Client timeout.
+	now := c.now()
+	expiration := n.expiration(now)
+	if ctx != nil && expiration.After(now) {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, expiration.Sub(now))
+		defer cancel()
+	}
+	// An expiration in the past is most likely a bug, as APNs then makes a
+	// single delivery attempt and drops the notification if the device is
+	// unreachable. Zero, the documented way to ask for that, is deliberate.
+	if !expiration.IsZero() && expiration.Before(now) && expiration.Unix() != 0 {
+		c.logf("apns2: expiration %s of notification for %s is already in the past; APNs will not store it for redelivery", expiration.Format(time.RFC3339), recipient(n))
+	}
+
+	if n.ChannelID != "" {
+		if d, release := c.reserveChannel(n.ChannelID); d > 0 && !wait(ctx, d) {
+			release()
+			return nil, &NetworkError{Err: ctx.Err()}
+		}
 	}
 
-	setHeaders(request, n)
+	// The slot is released to the same channel it was taken from, even if
+	// WithMaxConcurrentStreams replaces it meanwhile.
+	if streams != nil {
+		var done <-chan struct{}
+		if ctx != nil {
+			done = ctx.Done()
+		}
+		select {
+		case streams <- struct{}{}:
+		case <-done:
+			return nil, &NetworkError{Err: ctx.Err()}
+		}
+		defer func() { <-streams }()
+	}
 
-	response, err := c.HTTPClient.Do(request)
+	r, bearer, err := c.send(ctx, n, payload)
+	if err == nil && r.Reason == ReasonExpiredProviderToken && bearer != "" {
+		if err := c.regenerateToken(n, bearer); err != nil {
+			return r, err
+		}
+		r, _, err = c.send(ctx, n, payload)
+	}
 	if err != nil {
-		return nil, err
+		return r, err
+	}
+
+	if !r.Sent() {
+		c.recordError(r.Err())
+	} else if n.PushType == LiveActivity {
+		c.recordUpdate(n.DeviceToken)
+	}
+	if c.onInvalid != nil && n.ChannelID == "" {
+		switch r.Reason {
+		case ReasonBadDeviceToken, ReasonUnregistered, ReasonExpiredToken:
+			c.onInvalid(n.DeviceToken, r.Reason)
+		}
+	}
+	if c.requireUID && r.Sent() && r.ApnsUniqueId == "" {
+		return r, ErrMissingUniqueID
+	}
+	if dedup && r.Sent() {
+		c.dedupStore(key, r)
+	}
+	return r, nil
+}
+
+// send makes a single request to APNs for the notification, returning the
+// response along with the provider token bearer the request was
+// authenticated with, if any.
+func (c *Client) send(ctx Context, n *Notification, payload []byte) (*Response, string, error) {
+	request, httpClient, err := c.newRequest(ctx, n, payload)
+	if err != nil {
+		return nil, "", err
+	}
+	bearer := strings.TrimPrefix(request.Header.Get("authorization"), "bearer ")
+
+	if d := c.reconnectDelay(); d > 0 && !wait(ctx, d) {
+		return nil, bearer, &NetworkError{Err: ctx.Err()}
+	}
+	c.recycleIdleConnections()
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		if connectionLost(err) {
+			c.connectionFailed()
+		}
+		c.recordError(&NetworkError{Err: err})
+		return nil, bearer, &NetworkError{Err: err}
 	}
 	defer response.Body.Close()
+	c.connectionSucceeded()
 
 	r := &Response{}
 	r.StatusCode = response.StatusCode
 	r.ApnsID = response.Header.Get("apns-id")
 	r.ApnsUniqueId = response.Header.Get("apns-unique-id")
+	r.ChannelID = response.Header.Get("apns-channel-id")
+	r.TLS = response.TLS
+	if priority, err := strconv.Atoi(response.Header.Get("apns-priority")); err == nil {
+		r.EffectivePriority = priority
+	}
 
-	decoder := json.NewDecoder(response.Body)
-	if err := decoder.Decode(r); err != nil && err != io.EOF {
-		return &Response{}, err
+	// The status and headers are kept even when the body can't be read or
+	// decoded, so that the apns-id can be quoted in support requests.
+	body, err := ioutil.ReadAll(response.Body)
+	r.RawBody = body
+	if err != nil {
+		c.recordError(&NetworkError{Err: err})
+		return r, bearer, &NetworkError{Err: err}
 	}
-	return r, nil
+
+	if err := r.decodeBody(); err != nil {
+		return r, bearer, err
+	}
+	return r, bearer, nil
+}
+
+// recipient describes who the notification is for in log messages: its
+// broadcast channel, or its device token masked as by Redacted.
+func recipient(n *Notification) string {
+	if n.ChannelID != "" {
+		return "channel " + n.ChannelID
+	}
+	return "device token " + maskToken(n.DeviceToken)
+}
+
+// regenerateToken generates a new bearer for the provider token of the
+// notification after APNs rejected bearer as expired. Nothing is done if
+// another push has already replaced it, to avoid TooManyProviderTokenUpdates
+// when many pushes are rejected at once.
+func (c *Client) regenerateToken(n *Notification, bearer string) error {
+	t, _ := c.credentials(n)
+	if t == nil {
+		return nil
+	}
+	t.Lock()
+	defer t.Unlock()
+	if t.Bearer != bearer {
+		return nil
+	}
+	_, err := t.Generate()
+	return err
+}
+
+// withDefaults returns the notification with the Client's defaults applied
+// to any fields it leaves unset. n itself is not modified.
+func (c *Client) withDefaults(n *Notification) *Notification {
+	if n.Topic == "" && c.topic != "" {
+		m := *n
+		m.Topic = c.topic
+		if m.PushType == LiveActivity && !strings.HasSuffix(m.Topic, LiveActivityTopicSuffix) {
+			m.Topic += LiveActivityTopicSuffix
+		}
+		if m.PushType == PushTypeLocation && !strings.HasSuffix(m.Topic, LocationTopicSuffix) {
+			m.Topic += LocationTopicSuffix
+		}
+		n = &m
+	}
+	if n.Expiration.IsZero() && n.expireAfter == 0 && c.expireAfter > 0 {
+		m := *n
+		m.expireAfter = c.expireAfter
+		n = &m
+	}
+	if n.PushType == PushTypeLocation && n.Priority == 0 {
+		m := *n
+		m.Priority = PriorityHigh
+		n = &m
+	}
+	return n
+}
+
+// newRequest builds the HTTP request for the notification, authenticated and
+// with all of its headers set, along with the http.Client to send it with.
+func (c *Client) newRequest(ctx Context, n *Notification, payload []byte) (*http.Request, *http.Client, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(n), bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request.Close = c.noKeepAlive
+
+	httpClient := c.HTTPClient
+	switch t, cert := c.credentials(n); {
+	case t != nil:
+		setTokenHeader(request, t)
+	case cert != nil:
+		httpClient = c.certificateClient(cert)
+	}
+
+	setHeaders(request, n, c.now())
+	request.Header.Set("User-Agent", c.userAgentHeader())
+	return request, httpClient, nil
+}
+
+// url returns the URL the notification is pushed to: that of its device
+// token, or of the app's broadcasts for a notification to a channel.
+func (c *Client) url(n *Notification) string {
+	if n.ChannelID != "" {
+		return c.Host + "/4/broadcasts/apps/" + strings.TrimSuffix(n.Topic, LiveActivityTopicSuffix)
+	}
+	return c.Host + "/3/device/" + n.DeviceToken
+}
+
+// credentials returns the provider token or the certificate which
+// authenticates the notification, in order of precedence: its own Token, its
+// own Certificate or one from the CertStore for its topic, and then the
+// Client's Token. Both are nil if the Client's Certificate is to be used.
+func (c *Client) credentials(n *Notification) (*token.Token, *tls.Certificate) {
+	if n.Token != nil {
+		return n.Token, nil
+	}
+	cert := n.Certificate
+	if cert == nil && c.certStore != nil {
+		cert, _ = c.certStore.Get(n.Topic)
+	}
+	if cert != nil {
+		return nil, cert
+	}
+	return c.Token, nil
+}
+
+// userAgentHeader returns the User-Agent header to send with each request.
+func (c *Client) userAgentHeader() string {
+	if c.userAgent != "" {
+		return c.userAgent
+	}
+	return DefaultUserAgent
 }
 
 // CloseIdleConnections closes any underlying connections which were previously
@@ -206,14 +686,69 @@ func (c *Client) PushWithContext(ctx Context, n *Notification) (*Response, error
 // interrupt any connections currently in use.
 func (c *Client) CloseIdleConnections() {
 	c.HTTPClient.Transport.(connectionCloser).CloseIdleConnections()
+	c.closeCertificateClients()
+}
+
+// Shutdown stops the Client from accepting new pushes and waits for pushes
+// already in flight to complete. Once they have, idle connections are closed.
+// Pushes attempted after Shutdown has been called fail with ErrClientShutdown.
+//
+// If ctx is done before the in-flight pushes complete, Shutdown returns the
+// context's error. The pushes themselves are not interrupted.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	c.shutdown = true
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if closer, ok := c.HTTPClient.Transport.(connectionCloser); ok {
+		closer.CloseIdleConnections()
+	}
+	c.closeCertificateClients()
+	return nil
 }
 
-func (c *Client) setTokenHeader(r *http.Request) {
-	bearer := c.Token.GenerateIfExpired()
+func (c *Client) logf(format string, v ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, v...)
+	}
+}
+
+// tlsConfig returns the TLS configuration of the underlying transport,
+// creating an empty one if the transport doesn't have one yet. It returns nil
+// if the transport is not an *http2.Transport or *http.Transport.
+func (c *Client) tlsConfig() *tls.Config {
+	switch t := c.HTTPClient.Transport.(type) {
+	case *http2.Transport:
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		return t.TLSClientConfig
+	case *http.Transport:
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		return t.TLSClientConfig
+	}
+	return nil
+}
+
+func setTokenHeader(r *http.Request, t *token.Token) {
+	bearer := t.GenerateIfExpired()
 	r.Header.Set("authorization", "bearer "+bearer)
 }
 
-func setHeaders(r *http.Request, n *Notification) {
+func setHeaders(r *http.Request, n *Notification, now time.Time) {
 	r.Header.Set("Content-Type", "application/json; charset=utf-8")
 	if n.Topic != "" {
 		r.Header.Set("apns-topic", n.Topic)
@@ -227,13 +762,16 @@ func setHeaders(r *http.Request, n *Notification) {
 	if n.Priority > 0 {
 		r.Header.Set("apns-priority", strconv.Itoa(n.Priority))
 	}
-	if !n.Expiration.IsZero() {
-		r.Header.Set("apns-expiration", strconv.FormatInt(n.Expiration.Unix(), 10))
+	if expiration := n.expiration(now); !expiration.IsZero() {
+		r.Header.Set("apns-expiration", strconv.FormatInt(expiration.Unix(), 10))
 	}
 	if n.PushType != "" {
 		r.Header.Set("apns-push-type", string(n.PushType))
 	} else {
 		r.Header.Set("apns-push-type", string(PushTypeAlert))
 	}
-
+	if n.ChannelID != "" {
+		r.Header.Set("apns-channel-id", n.ChannelID)
+		r.Header.Set("apns-message-storage-policy", strconv.Itoa(n.StoragePolicy))
+	}
 }
@@ -1,18 +1,25 @@
 package apns2_test
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -20,6 +27,7 @@ import (
 
 	apns "github.com/mkc-bill/apns2"
 	"github.com/mkc-bill/apns2/certificate"
+	"github.com/mkc-bill/apns2/payload"
 	"github.com/mkc-bill/apns2/token"
 	"github.com/stretchr/testify/assert"
 )
@@ -44,7 +52,36 @@ func mockCert() tls.Certificate {
 }
 
 func mockClient(url string) *apns.Client {
-	return &apns.Client{Host: url, HTTPClient: http.DefaultClient}
+	return &apns.Client{Host: url, HTTPClient: &http.Client{}}
+}
+
+func mockTLSServer(handler http.HandlerFunc) *httptest.Server {
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	return server
+}
+
+// mockCountingTLSServer returns a TLS server along with a count of the
+// connections it has accepted.
+func mockCountingTLSServer() (*httptest.Server, *int32) {
+	var connections int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = true
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.StartTLS()
+	return server, &connections
+}
+
+func mockTLSClient(server *httptest.Server) *apns.Client {
+	client := apns.NewClient(mockCert())
+	client.Host = server.URL
+	client.HTTPClient.Transport.(*http2.Transport).TLSClientConfig.InsecureSkipVerify = true
+	return client
 }
 
 type mockTransport struct {
@@ -95,6 +132,22 @@ func TestClientBadUrlError(t *testing.T) {
 	assert.Nil(t, res)
 }
 
+func TestClientDialErrorIsNetworkError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	res, err := mockClient("http://" + address).Push(mockNotification())
+	assert.Nil(t, res)
+	var networkErr *apns.NetworkError
+	assert.True(t, errors.As(err, &networkErr))
+	var apnsErr *apns.APNsError
+	assert.False(t, errors.As(err, &apnsErr))
+}
+
 func TestClientBadTransportError(t *testing.T) {
 	n := mockNotification()
 	client := mockClient("badurl://badurl.com")
@@ -125,7 +178,55 @@ func TestClientNameToCertificate(t *testing.T) {
 	assert.Len(t, name2, 0)
 }
 
+func TestNewClientWithTransport(t *testing.T) {
+	transport := apns.NewTransport(nil)
+	client := apns.NewClientWithTransport(transport)
+	assert.Equal(t, transport, client.HTTPClient.Transport)
+	assert.Equal(t, apns.DefaultHost, client.Host)
+	assert.Equal(t, apns.HTTPClientTimeout, client.HTTPClient.Timeout)
+}
+
+func TestSharedTransportReusesConnection(t *testing.T) {
+	server, connections := mockCountingTLSServer()
+	defer server.Close()
+
+	transport := apns.NewTransport(&tls.Config{InsecureSkipVerify: true})
+	first := apns.NewClientWithTransport(transport)
+	first.Host = server.URL
+	first.Token = mockToken()
+	second := apns.NewClientWithTransport(transport)
+	second.Host = server.URL
+	second.Token = mockToken()
+
+	_, err := first.Push(mockNotification())
+	assert.NoError(t, err)
+	_, err = second.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(connections))
+}
+
+func TestConnectionReuse(t *testing.T) {
+	server, connections := mockCountingTLSServer()
+	defer server.Close()
+	client := mockTLSClient(server)
+	client.Push(mockNotification())
+	client.Push(mockNotification())
+	assert.Equal(t, int32(1), atomic.LoadInt32(connections))
+}
+
+func TestWithoutKeepAlive(t *testing.T) {
+	server, connections := mockCountingTLSServer()
+	defer server.Close()
+	client := mockTLSClient(server).WithoutKeepAlive()
+	_, err := client.Push(mockNotification())
+	assert.NoError(t, err)
+	_, err = client.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(connections))
+}
+
 func TestDialTLSTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { apns.TLSDialTimeout = timeout }(apns.TLSDialTimeout)
 	apns.TLSDialTimeout = 10 * time.Millisecond
 	crt, _ := certificate.FromP12File("certificate/_fixtures/certificate-valid.p12", "")
 	client := apns.NewClient(crt)
@@ -245,6 +346,72 @@ func TestHeaders(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestDefaultUserAgentHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, apns.DefaultUserAgent, r.Header.Get("User-Agent"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("User-Agent"), "apns2/"))
+	}))
+	defer server.Close()
+	_, err := mockClient(server.URL).Push(mockNotification())
+	assert.NoError(t, err)
+}
+
+func TestUserAgentHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "my-service/1.2.3", r.Header.Get("User-Agent"))
+	}))
+	defer server.Close()
+	_, err := mockClient(server.URL).WithUserAgent("my-service/1.2.3").Push(mockNotification())
+	assert.NoError(t, err)
+}
+
+func TestExpireAfterHeader(t *testing.T) {
+	n := mockNotification().ExpireAfter(5 * time.Minute)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1680000300", r.Header.Get("apns-expiration"))
+	}))
+	defer server.Close()
+	_, err := mockClient(server.URL).WithClock(mockClock(1680000000)).Push(n)
+	assert.NoError(t, err)
+}
+
+func TestExpireAfterExplicitExpirationWins(t *testing.T) {
+	n := mockNotification().ExpireAfter(5 * time.Minute)
+	n.Expiration = time.Unix(1700000000, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1700000000", r.Header.Get("apns-expiration"))
+	}))
+	defer server.Close()
+	_, err := mockClient(server.URL).Push(n)
+	assert.NoError(t, err)
+}
+
+func TestDefaultExpirationHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1680003600", r.Header.Get("apns-expiration"))
+	}))
+	defer server.Close()
+	client := mockClient(server.URL).WithClock(mockClock(1680000000)).WithDefaultExpiration(time.Hour)
+	_, err := client.Push(mockNotification())
+	assert.NoError(t, err)
+}
+
+func TestDefaultExpirationOverridden(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("apns-expiration"))
+	}))
+	defer server.Close()
+	client := mockClient(server.URL).WithClock(mockClock(1680000000)).WithDefaultExpiration(time.Hour)
+	_, err := client.Push(mockNotification().ExpireAfter(5 * time.Minute))
+	assert.NoError(t, err)
+	n := mockNotification()
+	n.Expiration = time.Unix(1700000000, 0)
+	_, err = client.Push(n)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1680000300", "1700000000"}, got)
+}
+
 func TestPushTypeAlertHeader(t *testing.T) {
 	n := mockNotification()
 	n.PushType = apns.PushTypeAlert
@@ -349,6 +516,43 @@ func TestPayload(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestPayloadWithoutHTMLEscape(t *testing.T) {
+	n := mockNotification()
+	n.Payload = payload.NewPayload().Alert("https://example.com/?a=1&b=2").DisableHTMLEscape()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"aps":{"alert":"https://example.com/?a=1&b=2"}}`, string(body))
+	}))
+	defer server.Close()
+	_, err := mockClient(server.URL).Push(n)
+	assert.NoError(t, err)
+}
+
+func TestRawPayloadSentVerbatim(t *testing.T) {
+	raw := []byte("{\n  \"aps\" : { \"alert\" : \"Hello & <welcome>\" }\n}")
+	for _, p := range []interface{}{raw, json.RawMessage(raw), string(raw)} {
+		n := mockNotification()
+		n.Payload = p
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, raw, body)
+		}))
+		_, err := mockClient(server.URL).Push(n)
+		assert.NoError(t, err)
+		server.Close()
+	}
+}
+
+func TestInvalidRawPayload(t *testing.T) {
+	n := mockNotification()
+	n.Payload = []byte(`{"aps":`)
+	res, err := mockClient("").Push(n)
+	assert.Equal(t, apns.ErrInvalidPayload, err)
+	assert.Nil(t, res)
+}
+
 func TestBadPayload(t *testing.T) {
 	n := mockNotification()
 	n.Payload = func() {}
@@ -372,6 +576,34 @@ func Test200SuccessResponse(t *testing.T) {
 	assert.Equal(t, true, res.Sent())
 }
 
+func TestChannelIDResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("apns-channel-id", "dHN0LXNyY2gtY2hubA==")
+	}))
+	defer server.Close()
+	res, err := mockClient(server.URL).Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, "dHN0LXNyY2gtY2hubA==", res.ChannelID)
+}
+
+func TestEffectivePriorityResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("apns-priority", "5")
+	}))
+	defer server.Close()
+	res, err := mockClient(server.URL).Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, 5, res.EffectivePriority)
+}
+
+func TestEffectivePriorityResponseMissing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	res, err := mockClient(server.URL).Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, res.EffectivePriority)
+}
+
 func Test400BadRequestPayloadEmptyResponse(t *testing.T) {
 	n := mockNotification()
 	var apnsID = "02ABC856-EF8D-4E49-8F15-7B8A61D978D6"
@@ -388,6 +620,41 @@ func Test400BadRequestPayloadEmptyResponse(t *testing.T) {
 	assert.Equal(t, apnsID, res.ApnsID)
 	assert.Equal(t, apns.ReasonPayloadEmpty, res.Reason)
 	assert.Equal(t, false, res.Sent())
+
+	var apnsErr *apns.APNsError
+	assert.True(t, errors.As(res.Err(), &apnsErr))
+	assert.Equal(t, 400, apnsErr.StatusCode)
+	assert.Equal(t, apns.ReasonPayloadEmpty, apnsErr.Reason)
+	assert.Equal(t, apnsID, apnsErr.ApnsID)
+	assert.EqualError(t, res.Err(), "apns2: notification rejected with status 400: PayloadEmpty")
+}
+
+func Test413PayloadTooLargeResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write([]byte(`{"reason":"PayloadTooLarge"}`))
+	}))
+	defer server.Close()
+	res, err := mockClient(server.URL).Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, apns.ReasonPayloadTooLarge, res.Reason)
+	assert.True(t, errors.Is(res.Err(), apns.ErrPayloadTooLarge))
+}
+
+func TestApnsIDOnUndecodableErrorResponse(t *testing.T) {
+	var apnsID = "02ABC856-EF8D-4E49-8F15-7B8A61D978D6"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("apns-id", apnsID)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"reason":400}`))
+	}))
+	defer server.Close()
+	res, err := mockClient(server.URL).Push(mockNotification())
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, apnsID, res.ApnsID)
+	assert.Equal(t, []byte(`{"reason":400}`), res.RawBody)
+	assert.False(t, res.Sent())
 }
 
 func Test410UnregisteredResponse(t *testing.T) {
@@ -418,9 +685,168 @@ func TestMalformedJSONResponse(t *testing.T) {
 	defer server.Close()
 	res, err := mockClient(server.URL).Push(n)
 	assert.Error(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, []byte("{{MalformedJSON}}"), res.RawBody)
+}
+
+func Test503HTMLResponse(t *testing.T) {
+	n := mockNotification()
+	body := "<html><body><h1>503 Service Unavailable</h1></body></html>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	res, err := mockClient(server.URL).Push(n)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, "", res.Reason)
+	assert.Equal(t, []byte(body), res.RawBody)
 	assert.Equal(t, false, res.Sent())
 }
 
+func TestRawBodyCapturedExactly(t *testing.T) {
+	body := "{ \"reason\": \"BadDeviceToken\",\n  \"extra\": [1, 2] }\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	res, err := mockClient(server.URL).Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, apns.ReasonBadDeviceToken, res.Reason)
+	assert.Equal(t, []byte(body), res.RawBody)
+}
+
+func TestRawBodyEmptyWhenSent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	res, err := mockClient(server.URL).Push(mockNotification())
+	assert.NoError(t, err)
+	assert.True(t, res.Sent())
+	assert.Empty(t, res.RawBody)
+}
+
+func TestResponseTLSConnectionState(t *testing.T) {
+	var serverVersion, serverCipher uint16
+	server := mockTLSServer(func(w http.ResponseWriter, r *http.Request) {
+		serverVersion = r.TLS.Version
+		serverCipher = r.TLS.CipherSuite
+	})
+	defer server.Close()
+	res, err := mockTLSClient(server).Push(mockNotification())
+	assert.NoError(t, err)
+	assert.NotNil(t, res.TLS)
+	assert.Equal(t, serverVersion, res.TLS.Version)
+	assert.Equal(t, serverCipher, res.TLS.CipherSuite)
+	assert.True(t, res.TLS.Version >= tls.VersionTLS12)
+}
+
+func TestResponseWithoutTLS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	res, err := mockClient(server.URL).Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Nil(t, res.TLS)
+}
+
+func TestLocalAddr(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	localAddr := listener.Addr().(*net.TCPAddr)
+	listener.Close()
+
+	var remoteAddr string
+	server := mockTLSServer(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+	})
+	defer server.Close()
+	_, err = mockTLSClient(server).WithLocalAddr(localAddr).Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, localAddr.String(), remoteAddr)
+}
+
+func TestServerPinMatch(t *testing.T) {
+	server := mockTLSServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+	pin := sha256.Sum256(server.Certificate().RawSubjectPublicKeyInfo)
+	client := mockTLSClient(server).WithServerPins([]byte("other"), pin[:])
+	res, err := client.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestServerPinMismatch(t *testing.T) {
+	server := mockTLSServer(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request should not reach the server")
+	})
+	defer server.Close()
+	pin := sha256.Sum256([]byte("wrong"))
+	client := mockTLSClient(server).WithServerPins(pin[:])
+	res, err := client.Push(mockNotification())
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, apns.ErrServerPinMismatch))
+	assert.Nil(t, res)
+}
+
+func TestShutdownDrainsInFlightPushes(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+	}))
+	defer server.Close()
+	client := mockClient(server.URL)
+
+	pushErr := make(chan error)
+	go func() {
+		_, err := client.Push(mockNotification())
+		pushErr <- err
+	}()
+	<-received
+
+	// The push is in flight, so a Shutdown with a cancelled context flags the
+	// Client as shut down and returns without waiting for it.
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, client.Shutdown(cancelled))
+
+	res, err := client.Push(mockNotification())
+	assert.Equal(t, apns.ErrClientShutdown, err)
+	assert.Nil(t, res)
+
+	shutdownErr := make(chan error)
+	go func() {
+		shutdownErr <- client.Shutdown(context.Background())
+	}()
+	close(release)
+	assert.NoError(t, <-pushErr)
+	assert.NoError(t, <-shutdownErr)
+}
+
+func TestShutdownContextDeadline(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	client := mockClient(server.URL)
+
+	go client.Push(mockNotification())
+	<-received
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, client.Shutdown(ctx))
+}
+
 func TestCloseIdleConnections(t *testing.T) {
 	transport := &mockTransport{}
 
@@ -431,3 +857,504 @@ func TestCloseIdleConnections(t *testing.T) {
 	client.CloseIdleConnections()
 	assert.Equal(t, true, transport.closed)
 }
+
+func TestRequireUniqueID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("apns-id", "40636A2C-C093-493E-936A-2A4333C06DEA")
+	}))
+	defer server.Close()
+
+	res, err := mockClient(server.URL).Push(mockNotification())
+	assert.NoError(t, err)
+	assert.True(t, res.Sent())
+
+	res, err = mockClient(server.URL).RequireUniqueID().Push(mockNotification())
+	assert.Equal(t, apns.ErrMissingUniqueID, err)
+	assert.Equal(t, "40636A2C-C093-493E-936A-2A4333C06DEA", res.ApnsID)
+}
+
+func TestRequireUniqueIDPresent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("apns-unique-id", "a6739c99-ee3d-4d32-9a36-1e2f6f5c4b60")
+	}))
+	defer server.Close()
+
+	res, err := mockClient(server.URL).RequireUniqueID().Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, "a6739c99-ee3d-4d32-9a36-1e2f6f5c4b60", res.ApnsUniqueId)
+}
+
+type countingSessionCache struct {
+	tls.ClientSessionCache
+	gets int32
+}
+
+func (c *countingSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	atomic.AddInt32(&c.gets, 1)
+	return c.ClientSessionCache.Get(sessionKey)
+}
+
+func TestWithSessionCache(t *testing.T) {
+	server := mockTLSServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+	cache := &countingSessionCache{ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+	client := mockTLSClient(server).WithSessionCache(cache)
+	assert.Equal(t, cache, client.HTTPClient.Transport.(*http2.Transport).TLSClientConfig.ClientSessionCache)
+
+	_, err := client.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.True(t, atomic.LoadInt32(&cache.gets) > 0)
+}
+
+func TestWithSessionCacheDefault(t *testing.T) {
+	client := apns.NewClient(mockCert()).WithSessionCache(nil)
+	assert.NotNil(t, client.HTTPClient.Transport.(*http2.Transport).TLSClientConfig.ClientSessionCache)
+}
+
+func TestBroadcastHeaders(t *testing.T) {
+	n := mockNotification()
+	n.Topic = "com.testapp.push-type.liveactivity"
+	n.PushType = apns.LiveActivity
+	n.ChannelID = "dHN0LXNyY2gtY2hubA=="
+	n.StoragePolicy = apns.StoragePolicyMostRecent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/4/broadcasts/apps/com.testapp", r.URL.Path)
+		assert.Equal(t, "dHN0LXNyY2gtY2hubA==", r.Header.Get("apns-channel-id"))
+		assert.Equal(t, "1", r.Header.Get("apns-message-storage-policy"))
+	}))
+	defer server.Close()
+	_, err := mockClient(server.URL).Push(n)
+	assert.NoError(t, err)
+}
+
+func TestStoragePolicyOnlyForBroadcast(t *testing.T) {
+	n := mockNotification()
+	n.StoragePolicy = apns.StoragePolicyMostRecent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/3/device/"+n.DeviceToken, r.URL.Path)
+		assert.Equal(t, "", r.Header.Get("apns-channel-id"))
+		assert.Equal(t, "", r.Header.Get("apns-message-storage-policy"))
+	}))
+	defer server.Close()
+	_, err := mockClient(server.URL).Push(n)
+	assert.NoError(t, err)
+}
+
+func TestDefaultTopic(t *testing.T) {
+	var topics []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		topics = append(topics, r.Header.Get("apns-topic"))
+	}))
+	defer server.Close()
+	client := mockClient(server.URL).WithDefaultTopic("com.testapp")
+
+	n := mockNotification()
+	client.Push(n)
+	n.PushType = apns.LiveActivity
+	client.Push(n)
+	assert.Equal(t, "", n.Topic)
+	n.Topic = "com.otherapp"
+	client.Push(n)
+
+	assert.Equal(t, []string{"com.testapp", "com.testapp.push-type.liveactivity", "com.otherapp"}, topics)
+}
+
+func TestWithMaxConcurrentStreams(t *testing.T) {
+	var inFlight, peak int32
+	server := mockTLSServer(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+	})
+	defer server.Close()
+	client := mockTLSClient(server).WithMaxConcurrentStreams(2)
+	assert.True(t, client.HTTPClient.Transport.(*http2.Transport).StrictMaxConcurrentStreams)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Push(mockNotification())
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.True(t, atomic.LoadInt32(&peak) <= 2)
+}
+
+func TestWithMaxConcurrentStreamsZero(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client := mockClient(server.URL).WithMaxConcurrentStreams(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := client.PushWithContext(ctx, mockNotification())
+	assert.NoError(t, err)
+	assert.True(t, res.Sent())
+}
+
+func TestWithMaxConcurrentStreamsChangedWhileInFlight(t *testing.T) {
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+	defer server.Close()
+	client := mockClient(server.URL).WithMaxConcurrentStreams(1)
+
+	pushErr := make(chan error)
+	go func() {
+		_, err := client.Push(mockNotification())
+		pushErr <- err
+	}()
+	<-received
+
+	client.WithMaxConcurrentStreams(2)
+	close(release)
+	select {
+	case err := <-pushErr:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("push did not return after the limit was changed")
+	}
+}
+
+func TestWithMaxConcurrentStreamsCancelledWhileWaiting(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	client := mockClient(server.URL).WithMaxConcurrentStreams(1)
+
+	go client.Push(mockNotification())
+	<-received
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err := client.PushWithContext(ctx, mockNotification())
+	assert.Nil(t, res)
+	var networkErr *apns.NetworkError
+	assert.True(t, errors.As(err, &networkErr))
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestOnInvalidToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/gone") {
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason":"Unregistered","timestamp":1458114061260}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"reason":"ServiceUnavailable"}`))
+	}))
+	defer server.Close()
+
+	var tokens, reasons []string
+	client := mockClient(server.URL).OnInvalidToken(func(token string, reason string) {
+		tokens = append(tokens, token)
+		reasons = append(reasons, reason)
+	})
+	n := mockNotification()
+	client.Push(n)
+	n.DeviceToken = "gone"
+	res, err := client.Push(n)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusGone, res.StatusCode)
+
+	assert.Equal(t, []string{"gone"}, tokens)
+	assert.Equal(t, []string{apns.ReasonUnregistered}, reasons)
+}
+
+type mockTokenStore struct {
+	removed []string
+}
+
+func (s *mockTokenStore) Remove(token string) {
+	s.removed = append(s.removed, token)
+}
+
+func TestWithTokenStore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/gone"):
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason":"Unregistered","timestamp":1458114061260}`))
+		case strings.HasSuffix(r.URL.Path, "/bad"):
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason":"BadDeviceToken"}`))
+		case strings.HasSuffix(r.URL.Path, "/topic"):
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason":"BadTopic"}`))
+		}
+	}))
+	defer server.Close()
+
+	store := &mockTokenStore{}
+	client := mockClient(server.URL).WithTokenStore(store)
+	for _, token := range []string{"ok", "gone", "topic", "bad"} {
+		n := mockNotification()
+		n.DeviceToken = token
+		_, err := client.Push(n)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"gone", "bad"}, store.removed)
+}
+
+func TestExpirationShortensDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	n := mockNotification()
+	n.Expiration = time.Now().Add(50 * time.Millisecond)
+	start := time.Now()
+	_, err := mockClient(server.URL).Push(n)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+}
+
+func TestPastExpirationStillSent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1", r.Header.Get("apns-expiration"))
+	}))
+	defer server.Close()
+
+	n := mockNotification()
+	n.Expiration = time.Unix(1, 0)
+	_, err := mockClient(server.URL).Push(n)
+	assert.NoError(t, err)
+}
+
+func TestPastExpirationWarning(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEqual(t, "", r.Header.Get("apns-expiration"))
+	}))
+	defer server.Close()
+	var buf bytes.Buffer
+	client := mockClient(server.URL).WithLogger(log.New(&buf, "", 0))
+
+	n := mockNotification()
+	n.Expiration = time.Now().Add(-time.Minute)
+	res, err := client.Push(n)
+	assert.NoError(t, err)
+	assert.True(t, res.Sent())
+	assert.Contains(t, buf.String(), "already in the past")
+	assert.Contains(t, buf.String(), "device token 11aa...9ef7")
+	assert.NotContains(t, buf.String(), n.DeviceToken)
+
+	buf.Reset()
+	n.DeviceToken = ""
+	n.ChannelID = "dGVhbS1h"
+	n.Topic = "com.testapp.push-type.liveactivity"
+	client.Push(n)
+	assert.Contains(t, buf.String(), "channel dGVhbS1h")
+}
+
+func TestExpirationWarningNotLoggedForZeroOrFuture(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	var buf bytes.Buffer
+	client := mockClient(server.URL).WithLogger(log.New(&buf, "", 0))
+
+	n := mockNotification()
+	n.Expiration = time.Unix(0, 0)
+	client.Push(n)
+	n.Expiration = time.Now().Add(time.Hour)
+	client.Push(n)
+	assert.Equal(t, "", buf.String())
+}
+
+func TestWithRootCAs(t *testing.T) {
+	server := mockTLSServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	client := apns.NewClient(mockCert())
+	client.Host = server.URL
+	_, err := client.Push(mockNotification())
+	assert.Error(t, err)
+
+	client = apns.NewClient(mockCert()).WithRootCAs(pool)
+	client.Host = server.URL
+	res, err := client.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.True(t, res.Sent())
+}
+
+func TestLocationPushDefaults(t *testing.T) {
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header)
+	}))
+	defer server.Close()
+	client := mockClient(server.URL).WithDefaultTopic("com.testapp")
+
+	n := mockNotification()
+	n.PushType = apns.PushTypeLocation
+	client.Push(n)
+	n.Priority = apns.PriorityLow
+	client.Push(n)
+
+	assert.Equal(t, "location", headers[0].Get("apns-push-type"))
+	assert.Equal(t, "10", headers[0].Get("apns-priority"))
+	assert.Equal(t, "com.testapp.location-query", headers[0].Get("apns-topic"))
+	assert.Equal(t, "5", headers[1].Get("apns-priority"))
+	assert.Equal(t, apns.PriorityLow, n.Priority)
+}
+
+func TestTokenNearExpiryRefreshedBeforePush(t *testing.T) {
+	var bearers []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearers = append(bearers, r.Header.Get("authorization"))
+	}))
+	defer server.Close()
+
+	tkn := mockToken()
+	tkn.Generate()
+	stale := tkn.Bearer
+	tkn.IssuedAt = time.Now().Add(-55 * time.Minute).Unix()
+	client := mockClient(server.URL)
+	client.Token = tkn
+
+	_, err := client.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.NotEqual(t, "bearer "+stale, bearers[0])
+	assert.Equal(t, "bearer "+tkn.Bearer, bearers[0])
+	assert.True(t, time.Now().Unix()-tkn.IssuedAt < 5)
+
+	fresh := tkn.Bearer
+	tkn.IssuedAt = time.Now().Add(-45 * time.Minute).Unix()
+	client.Push(mockNotification())
+	assert.Equal(t, "bearer "+fresh, bearers[1])
+}
+
+func TestExpiredProviderTokenRetry(t *testing.T) {
+	var bearers []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearers = append(bearers, r.Header.Get("authorization"))
+		if len(bearers) == 1 {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"reason":"ExpiredProviderToken"}`))
+		}
+	}))
+	defer server.Close()
+	client := mockClient(server.URL)
+	client.Token = mockToken()
+	client.Token.Generate()
+
+	res, err := client.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.True(t, res.Sent())
+	assert.Len(t, bearers, 2)
+	assert.NotEqual(t, bearers[0], bearers[1])
+	assert.Equal(t, "bearer "+client.Token.Bearer, bearers[1])
+}
+
+func TestExpiredProviderTokenRetriedOnce(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"reason":"ExpiredProviderToken"}`))
+	}))
+	defer server.Close()
+	client := mockClient(server.URL)
+	client.Token = mockToken()
+
+	res, err := client.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, apns.ReasonExpiredProviderToken, res.Reason)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestExpiredProviderTokenRefreshedDuringFirstAttempt(t *testing.T) {
+	var bearers []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearers = append(bearers, r.Header.Get("authorization"))
+		if len(bearers) == 1 {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"reason":"ExpiredProviderToken"}`))
+		}
+	}))
+	defer server.Close()
+	client := mockClient(server.URL)
+	client.Token = mockToken()
+
+	res, err := client.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.True(t, res.Sent())
+	assert.Len(t, bearers, 2)
+	assert.NotEqual(t, bearers[0], bearers[1])
+}
+
+func TestExpiredProviderTokenRegenerateError(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"reason":"ExpiredProviderToken"}`))
+	}))
+	defer server.Close()
+	client := mockClient(server.URL)
+	client.Token = &token.Token{Bearer: "stale", IssuedAt: time.Now().Unix()}
+
+	res, err := client.Push(mockNotification())
+	assert.Equal(t, token.ErrAuthKeyNil, err)
+	assert.Equal(t, apns.ReasonExpiredProviderToken, res.Reason)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestExpiredProviderTokenRetryCountsUpdateOnce(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"reason":"ExpiredProviderToken"}`))
+		}
+	}))
+	defer server.Close()
+	var buf bytes.Buffer
+	client := mockClient(server.URL).WithLogger(log.New(&buf, "", 0)).WithFrequentUpdatesWarning(1)
+	client.Token = mockToken()
+
+	n := mockNotification()
+	n.PushType = apns.LiveActivity
+	res, err := client.Push(n)
+	assert.NoError(t, err)
+	assert.True(t, res.Sent())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, "", buf.String())
+}
+
+func TestExpiredProviderTokenNotRetriedWithoutToken(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"reason":"ExpiredProviderToken"}`))
+	}))
+	defer server.Close()
+
+	res, err := mockClient(server.URL).Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, apns.ReasonExpiredProviderToken, res.Reason)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,47 @@
+package apns2
+
+import "time"
+
+// LargeClockSkew is the offset beyond which WithClockSkew logs a warning, as
+// a skew this large usually means the server clock needs fixing.
+const LargeClockSkew = 5 * time.Minute
+
+// WithClockSkew sets an offset added to the current time when resolving
+// timestamps at send time, such as those set with the Live Activity payload
+// builder's TimestampNow. Use it to correct a server clock known to be wrong,
+// as APNs discards Live Activity updates with stale timestamps, until the
+// clock itself is fixed. An offset larger than LargeClockSkew is logged to
+// the client's logger, so set one with WithLogger first.
+func (c *Client) WithClockSkew(offset time.Duration) *Client {
+	if offset > LargeClockSkew || offset < -LargeClockSkew {
+		c.logf("apns2: clock skew of %v is large, check the server clock", offset)
+	}
+	c.clockSkew = offset
+	return c
+}
+
+// Clock tells the current time. The Client uses the system clock unless
+// another is set with WithClock, for example to freeze time in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// WithClock sets the clock the Client uses to resolve timestamps and
+// expirations, and to age its deduplication and update frequency records.
+func (c *Client) WithClock(clock Clock) *Client {
+	c.clock = clock
+	return c
+}
+
+// now returns the current time according to the client's clock.
+func (c *Client) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
+
+// timestampNow returns the current time adjusted by the client's clock skew.
+func (c *Client) timestampNow() time.Time {
+	return c.now().Add(c.clockSkew)
+}
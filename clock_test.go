@@ -0,0 +1,84 @@
+package apns2_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apns "github.com/mkc-bill/apns2"
+	liveactivity "github.com/mkc-bill/apns2/liveactivitypayload"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockSkewAppliedToTimestampNow(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	n := mockNotification()
+	n.PushType = apns.LiveActivity
+	n.Payload = liveactivity.NewPayload().Event(liveactivity.EventEnd).TimestampNow()
+	_, err := mockClient(server.URL).WithClock(mockClock(1680000000)).WithClockSkew(time.Hour).Push(n)
+	assert.NoError(t, err)
+
+	var sent struct {
+		Aps struct {
+			Timestamp int64 `json:"timestamp"`
+		} `json:"aps"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &sent))
+	assert.Equal(t, int64(1680003600), sent.Aps.Timestamp)
+}
+
+func TestClockSkewIgnoresFixedTimestamp(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	n := mockNotification()
+	n.Payload = liveactivity.NewPayload().Event(liveactivity.EventEnd).Timestamp(1000)
+	_, err := mockClient(server.URL).WithClockSkew(time.Hour).Push(n)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"aps":{"timestamp":1000,"event":"end"}}`, string(body))
+}
+
+func TestEstimateBatchUsesClientClock(t *testing.T) {
+	n := mockNotification()
+	n.Payload = liveactivity.NewPayload().Event(liveactivity.EventEnd).TimestampNow()
+	total, errs := mockClient("").WithClock(mockClock(1000)).EstimateBatch([]*apns.Notification{n})
+	assert.Nil(t, errs)
+	assert.Equal(t, len(`{"aps":{"timestamp":1000,"event":"end"}}`), total)
+}
+
+func TestLargeClockSkewWarning(t *testing.T) {
+	var buf bytes.Buffer
+	client := mockClient("").WithLogger(log.New(&buf, "", 0))
+
+	client.WithClockSkew(time.Minute)
+	assert.Equal(t, "", buf.String())
+
+	client.WithClockSkew(-time.Hour)
+	assert.Contains(t, buf.String(), "clock skew of -1h0m0s is large")
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+// mockClock returns a Clock frozen at the given Unix time.
+func mockClock(unix int64) *fakeClock {
+	return &fakeClock{now: time.Unix(unix, 0)}
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
@@ -0,0 +1,89 @@
+package apns2
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Payloader is implemented by payloads which marshal themselves to JSON, such
+// as those of the payload and liveactivitypayload builders.
+type Payloader interface {
+	MarshalJSON() ([]byte, error)
+}
+
+// MaxCollapseIDLength is the maximum length in bytes APNs accepts for the
+// apns-collapse-id header.
+const MaxCollapseIDLength = 64
+
+// CollapseIDFromPayload returns a collapse identifier derived from a hash of
+// the marshalled payload, for use as a Notification's CollapseID. Identical
+// payloads yield the same identifier and different ones differ, so only
+// notifications whose content did not change are collapsed. The identifier
+// is 64 hexadecimal characters, within the limit APNs allows. It returns ""
+// if the payload cannot be marshalled.
+//
+// The payload is hashed in a canonical form, with the keys of every object
+// sorted and insignificant whitespace removed, so the same logical content,
+// such as a Live Activity content-state built in a different order, always
+// yields the same identifier.
+func CollapseIDFromPayload(p Payloader) string {
+	b, err := p.MarshalJSON()
+	if err != nil {
+		return ""
+	}
+	if b, err = canonicalJSON(b); err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalJSON re-encodes the JSON document b with the keys of every object
+// sorted. Numbers are kept exactly as written.
+func canonicalJSON(b []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// SafeCollapseID returns s if it fits within MaxCollapseIDLength, and
+// otherwise a 64 character hexadecimal hash of s, so that collapse
+// identifiers derived from long business keys are not rejected by APNs. The
+// result is stable, so the same key always collapses with itself.
+func SafeCollapseID(s string) string {
+	if len(s) <= MaxCollapseIDLength {
+		return s
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// duplicateCollapseIDs returns, for each notification, the index of an
+// earlier one with the same collapse ID, topic and recipient, which it would
+// replace on the device, or -1 if there is none.
+func duplicateCollapseIDs(notifications []*Notification) []int {
+	type key struct {
+		collapseID, topic, deviceToken, channelID string
+	}
+	seen := map[key]int{}
+	duplicates := make([]int, len(notifications))
+	for i, n := range notifications {
+		duplicates[i] = -1
+		if n.CollapseID == "" {
+			continue
+		}
+		k := key{n.CollapseID, n.Topic, n.DeviceToken, n.ChannelID}
+		if j, ok := seen[k]; ok {
+			duplicates[i] = j
+			continue
+		}
+		seen[k] = i
+	}
+	return duplicates
+}
@@ -0,0 +1,65 @@
+package apns2_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	apns "github.com/mkc-bill/apns2"
+	"github.com/mkc-bill/apns2/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollapseIDFromPayload(t *testing.T) {
+	first := apns.CollapseIDFromPayload(payload.NewPayload().Alert("score 1-0").Custom("match", 7))
+	same := apns.CollapseIDFromPayload(payload.NewPayload().Alert("score 1-0").Custom("match", 7))
+	other := apns.CollapseIDFromPayload(payload.NewPayload().Alert("score 2-0").Custom("match", 7))
+
+	assert.Equal(t, first, same)
+	assert.NotEqual(t, first, other)
+	assert.Len(t, first, 64)
+}
+
+func TestCollapseIDFromPayloadKeyOrder(t *testing.T) {
+	first := map[string]interface{}{}
+	first["home"] = 1
+	first["away"] = 0
+	first["period"] = "2nd"
+	second := map[string]interface{}{}
+	second["period"] = "2nd"
+	second["away"] = 0
+	second["home"] = 1
+	assert.Equal(t,
+		apns.CollapseIDFromPayload(payload.NewPayload().Custom("content-state", first)),
+		apns.CollapseIDFromPayload(payload.NewPayload().Custom("content-state", second)))
+
+	ordered := json.RawMessage(`{"aps":{"content-state":{"home":1,"away":0,"period":"2nd"}}}`)
+	reordered := json.RawMessage(`{ "aps": { "content-state": { "period": "2nd", "away": 0, "home": 1 } } }`)
+	changed := json.RawMessage(`{"aps":{"content-state":{"home":2,"away":0,"period":"2nd"}}}`)
+	assert.Equal(t, apns.CollapseIDFromPayload(ordered), apns.CollapseIDFromPayload(reordered))
+	assert.NotEqual(t, apns.CollapseIDFromPayload(ordered), apns.CollapseIDFromPayload(changed))
+}
+
+type failingPayload struct{}
+
+func (failingPayload) MarshalJSON() ([]byte, error) {
+	return nil, apns.ErrInvalidPayload
+}
+
+func TestCollapseIDFromPayloadError(t *testing.T) {
+	assert.Equal(t, "", apns.CollapseIDFromPayload(failingPayload{}))
+}
+
+func TestSafeCollapseIDShort(t *testing.T) {
+	assert.Equal(t, "match-7-score", apns.SafeCollapseID("match-7-score"))
+	exact := strings.Repeat("a", apns.MaxCollapseIDLength)
+	assert.Equal(t, exact, apns.SafeCollapseID(exact))
+}
+
+func TestSafeCollapseIDLong(t *testing.T) {
+	long := strings.Repeat("tenant/42/match/7/", 10)
+	id := apns.SafeCollapseID(long)
+	assert.Len(t, id, apns.MaxCollapseIDLength)
+	assert.Equal(t, id, apns.SafeCollapseID(long))
+	assert.NotEqual(t, id, apns.SafeCollapseID(long+"x"))
+}
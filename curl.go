@@ -0,0 +1,50 @@
+package apns2
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// CurlCommand returns a curl invocation equivalent to pushing n with the
+// Client, including its headers and payload, to reproduce a push outside of
+// the application, for example when working with Apple support. The
+// authorization header is redacted, and certificate based Clients need the
+// --cert and --key options of curl added by hand. The notification is not
+// sent.
+func (c *Client) CurlCommand(n *Notification) (string, error) {
+	n = c.withDefaults(n)
+	payload, err := n.marshalPayload(c.timestampNow())
+	if err != nil {
+		return "", err
+	}
+
+	// The headers are set directly rather than by newRequest, which would
+	// refresh an expired provider token and create certificate clients.
+	request := &http.Request{Header: http.Header{}}
+	setHeaders(request, n, c.now())
+	request.Header.Set("User-Agent", c.userAgentHeader())
+	if t, _ := c.credentials(n); t != nil {
+		request.Header.Set("authorization", "bearer <redacted>")
+	}
+
+	keys := make([]string, 0, len(request.Header))
+	for key := range request.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("curl --http2 -X POST")
+	for _, key := range keys {
+		b.WriteString(" -H " + shellQuote(strings.ToLower(key)+": "+request.Header.Get(key)))
+	}
+	b.WriteString(" --data " + shellQuote(string(payload)))
+	b.WriteString(" " + shellQuote(c.url(n)))
+	return b.String(), nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
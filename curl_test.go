@@ -0,0 +1,33 @@
+package apns2_test
+
+import (
+	"testing"
+
+	apns "github.com/mkc-bill/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurlCommand(t *testing.T) {
+	client := apns.NewTokenClient(mockToken()).Production()
+	n := mockNotification()
+	n.Topic = "com.testapp.push-type.liveactivity"
+	n.PushType = apns.LiveActivity
+	n.Payload = []byte(`{"aps":{"alert":"It's here"}}`)
+
+	cmd, err := client.CurlCommand(n)
+	assert.NoError(t, err)
+	assert.Contains(t, cmd, "curl --http2 -X POST")
+	assert.Contains(t, cmd, "'https://api.push.apple.com/3/device/"+n.DeviceToken+"'")
+	assert.Contains(t, cmd, "-H 'apns-topic: com.testapp.push-type.liveactivity'")
+	assert.Contains(t, cmd, "-H 'apns-push-type: liveactivity'")
+	assert.Contains(t, cmd, "-H 'authorization: bearer <redacted>'")
+	assert.Equal(t, "", client.Token.Bearer)
+	assert.Contains(t, cmd, `--data '{"aps":{"alert":"It'\''s here"}}'`)
+}
+
+func TestCurlCommandBadPayload(t *testing.T) {
+	n := mockNotification()
+	n.Payload = []byte(`{`)
+	_, err := mockClient("https://localhost").CurlCommand(n)
+	assert.Equal(t, apns.ErrInvalidPayload, err)
+}
@@ -0,0 +1,71 @@
+package apns2
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+type dedupEntry struct {
+	response *Response
+	expires  time.Time
+}
+
+// WithDedup makes the Client skip pushes identical to one it has successfully
+// sent within the last ttl. Two pushes are identical when they have the same
+// device token or broadcast channel, topic, push type, collapse ID and
+// payload. A skipped push is not sent to APNs;
+// instead a copy of the Response to the original push is returned. This
+// protects against duplicate updates caused by upstream systems redelivering
+// messages. A ttl of zero disables deduplication.
+func (c *Client) WithDedup(ttl time.Duration) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dedupTTL = ttl
+	c.dedup = nil
+	return c
+}
+
+func dedupKey(n *Notification, payload []byte) string {
+	h := sha256.New()
+	for _, field := range []string{n.DeviceToken, n.ChannelID, n.Topic, string(n.PushType), n.CollapseID} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// dedupLookup returns the Response to a previous identical push, if one was
+// sent within the dedup ttl.
+func (c *Client) dedupLookup(key string) (*Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.dedup[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.dedup, key)
+		return nil, false
+	}
+	res := *entry.response
+	return &res, true
+}
+
+// dedupStore records a successful push, pruning any expired entries.
+func (c *Client) dedupStore(key string, res *Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if c.dedup == nil {
+		c.dedup = map[string]dedupEntry{}
+	}
+	for k, entry := range c.dedup {
+		if !now.Before(entry.expires) {
+			delete(c.dedup, k)
+		}
+	}
+	stored := *res
+	c.dedup[key] = dedupEntry{response: &stored, expires: now.Add(c.dedupTTL)}
+}
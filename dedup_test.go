@@ -0,0 +1,111 @@
+package apns2_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apns "github.com/mkc-bill/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupSkipsIdenticalPush(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("apns-id", "02ABC856-EF8D-4E49-8F15-7B8A61D978D6")
+	}))
+	defer server.Close()
+	client := mockClient(server.URL).WithDedup(time.Minute)
+
+	n := mockNotification()
+	n.CollapseID = "score"
+	first, err := client.Push(n)
+	assert.NoError(t, err)
+	second, err := client.Push(n)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, first.ApnsID, second.ApnsID)
+	assert.True(t, second.Sent())
+}
+
+func TestDedupSendsDifferentPushes(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+	client := mockClient(server.URL).WithDedup(time.Minute)
+
+	n := mockNotification()
+	client.Push(n)
+	n.Payload = []byte(`{"aps":{"alert":"Changed!"}}`)
+	client.Push(n)
+	n.CollapseID = "other"
+	client.Push(n)
+	n.DeviceToken = "22bb01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7"
+	client.Push(n)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestDedupExpires(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+	clock := mockClock(1680000000)
+	client := mockClient(server.URL).WithClock(clock).WithDedup(time.Minute)
+
+	client.Push(mockNotification())
+	clock.Advance(59 * time.Second)
+	client.Push(mockNotification())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	clock.Advance(time.Second)
+	client.Push(mockNotification())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestDedupIgnoresFailedPush(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	client := mockClient(server.URL).WithDedup(time.Minute)
+
+	res, _ := client.Push(mockNotification())
+	assert.False(t, res.Sent())
+	res, _ = client.Push(mockNotification())
+	assert.True(t, res.Sent())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestDedupDistinguishesChannelsAndTopics(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+	client := mockClient(server.URL).WithDedup(time.Minute)
+
+	for _, channelID := range []string{"dGVhbS1h", "dGVhbS1i"} {
+		n := &apns.Notification{ChannelID: channelID, Topic: "com.testapp.push-type.liveactivity", Payload: []byte(`{"aps":{}}`)}
+		_, err := client.Push(n)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	for _, topic := range []string{"com.testapp", "com.otherapp"} {
+		n := mockNotification()
+		n.Topic = topic
+		_, err := client.Push(n)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,61 @@
+package apns2
+
+import "errors"
+
+// The APNs environments a Client can be required to send to with
+// RequireEnvironment.
+const (
+	EnvironmentDevelopment = "development"
+	EnvironmentProduction  = "production"
+)
+
+// Possible errors when a Client is required to send to a given environment.
+var (
+	ErrEnvironmentNotChosen = errors.New("apns2: no environment chosen, call Development or Production before pushing")
+	ErrEnvironmentMismatch  = errors.New("apns2: client environment does not match the required environment")
+)
+
+// RequireEnvironment makes pushes fail with ErrEnvironmentNotChosen until the
+// environment has been chosen explicitly with Development or Production, and
+// with ErrEnvironmentMismatch if the one chosen is not env. Provider tokens
+// are accepted by both environments, so this guards against a token based
+// Client accidentally sending to production, or a production service
+// sending to the sandbox. Setting Host directly does not choose an
+// environment.
+func (c *Client) RequireEnvironment(env string) *Client {
+	c.requiredEnv = env
+	return c
+}
+
+// ForProduction chooses the production environment if production is true or
+// the development environment otherwise, as Production or Development would,
+// and locks the Client to it as RequireEnvironment does. Later calls to
+// Production or Development which switch the Client to the other environment
+// make every push fail with ErrEnvironmentMismatch instead of silently
+// sending to the wrong host. It is intended to be called once, as the Client
+// is created, from configuration:
+//
+//	client := apns2.NewClient(cert).ForProduction(cfg.Production)
+func (c *Client) ForProduction(production bool) *Client {
+	if production {
+		c.Production()
+	} else {
+		c.Development()
+	}
+	return c.RequireEnvironment(c.environment)
+}
+
+// checkEnvironment returns an error if the Client is required to send to an
+// environment other than the one explicitly chosen.
+func (c *Client) checkEnvironment() error {
+	if c.requiredEnv == "" {
+		return nil
+	}
+	if c.environment == "" {
+		return ErrEnvironmentNotChosen
+	}
+	if c.environment != c.requiredEnv {
+		return ErrEnvironmentMismatch
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package apns2_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apns "github.com/mkc-bill/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireEnvironmentNotChosen(t *testing.T) {
+	client := apns.NewTokenClient(mockToken()).RequireEnvironment(apns.EnvironmentProduction)
+	res, err := client.Push(mockNotification())
+	assert.Nil(t, res)
+	assert.Equal(t, apns.ErrEnvironmentNotChosen, err)
+}
+
+func TestRequireEnvironmentMismatch(t *testing.T) {
+	client := apns.NewTokenClient(mockToken()).Development().RequireEnvironment(apns.EnvironmentProduction)
+	_, err := client.Push(mockNotification())
+	assert.Equal(t, apns.ErrEnvironmentMismatch, err)
+}
+
+func TestRequireEnvironmentChosen(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client := mockClient(server.URL).RequireEnvironment(apns.EnvironmentDevelopment).Development()
+	client.Host = server.URL
+	res, err := client.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.True(t, res.Sent())
+}
+
+// hostTransport accepts every request, recording the hosts they were sent to.
+type hostTransport struct {
+	hosts []string
+}
+
+func (t *hostTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.hosts = append(t.hosts, r.URL.Scheme+"://"+r.URL.Host)
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("")), Header: http.Header{}}, nil
+}
+
+func TestForProduction(t *testing.T) {
+	for production, host := range map[bool]string{true: apns.HostProduction, false: apns.HostDevelopment} {
+		transport := &hostTransport{}
+		client := (&apns.Client{HTTPClient: &http.Client{Transport: transport}}).ForProduction(production)
+		for i := 0; i < 3; i++ {
+			res, err := client.Push(mockNotification())
+			assert.NoError(t, err)
+			assert.True(t, res.Sent())
+		}
+		assert.Equal(t, []string{host, host, host}, transport.hosts)
+	}
+}
+
+func TestForProductionLocked(t *testing.T) {
+	transport := &hostTransport{}
+	client := (&apns.Client{HTTPClient: &http.Client{Transport: transport}}).ForProduction(true).Development()
+	_, err := client.Push(mockNotification())
+	assert.Equal(t, apns.ErrEnvironmentMismatch, err)
+	assert.Empty(t, transport.hosts)
+}
@@ -0,0 +1,55 @@
+package apns2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrPayloadTooLarge matches, with errors.Is, the *APNsError of a
+// notification APNs rejected with 413 PayloadTooLarge. Unlike most
+// rejections it can be fixed by trimming the payload and pushing again.
+var ErrPayloadTooLarge = errors.New("apns2: payload too large")
+
+// NetworkError is returned when a push fails because of a transport level
+// problem, such as a failed dial, a TLS error or a dropped connection. The
+// notification may not have reached APNs, so it is generally safe to retry.
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying transport error.
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// APNsError describes a notification which reached APNs and was rejected.
+// Retrying the same notification will usually be rejected again.
+type APNsError struct {
+	// The HTTP status code returned by APNs.
+	StatusCode int
+
+	// The APNs error string indicating the reason for the rejection.
+	Reason string
+
+	// The apns-id of the rejected notification.
+	ApnsID string
+}
+
+func (e *APNsError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("apns2: notification rejected with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("apns2: notification rejected with status %d: %s", e.StatusCode, e.Reason)
+}
+
+// Is reports whether the rejection matches target, so that errors.Is(err,
+// ErrPayloadTooLarge) picks out a payload APNs rejected for its size.
+func (e *APNsError) Is(target error) bool {
+	return target == ErrPayloadTooLarge &&
+		(e.StatusCode == http.StatusRequestEntityTooLarge || e.Reason == ReasonPayloadTooLarge)
+}
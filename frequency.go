@@ -0,0 +1,148 @@
+package apns2
+
+import "time"
+
+// updateMonitor tracks how often Live Activity notifications are pushed to
+// each device token.
+type updateMonitor struct {
+	perHour   int
+	pushes    map[string][]time.Time
+	warned    map[string]time.Time
+	lastSweep time.Time
+}
+
+// WithFrequentUpdatesWarning makes the Client log a warning the first time
+// APNs accepts more than perHour Live Activity notifications for a single
+// device token within an hour, and again at most once an hour while it keeps
+// doing so. Apps that update Live Activities this often need the
+// NSSupportsLiveActivitiesFrequentUpdates entitlement, which the Client can't
+// check for, or APNs will throttle the updates. A perHour of zero disables the
+// warning. Warnings are reported to the Logger set with WithLogger.
+func (c *Client) WithFrequentUpdatesWarning(perHour int) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.updates = nil
+	if perHour > 0 {
+		c.updates = &updateMonitor{
+			perHour: perHour,
+			pushes:  map[string][]time.Time{},
+			warned:  map[string]time.Time{},
+		}
+	}
+	return c
+}
+
+// recordUpdate counts a Live Activity push APNs accepted for the device
+// token, warning if the token has exceeded the configured hourly threshold.
+func (c *Client) recordUpdate(deviceToken string) {
+	c.mu.Lock()
+	m := c.updates
+	if m == nil {
+		c.mu.Unlock()
+		return
+	}
+	now := c.now()
+	cutoff := now.Add(-time.Hour)
+	m.sweep(now, cutoff)
+	if _, ok := m.warned[deviceToken]; ok {
+		c.mu.Unlock()
+		return
+	}
+	pushes := m.pushes[deviceToken]
+	for len(pushes) > 0 && !pushes[0].After(cutoff) {
+		pushes = pushes[1:]
+	}
+	pushes = append(pushes, now)
+	exceeded := len(pushes) > m.perHour
+	if exceeded {
+		m.warned[deviceToken] = now
+		delete(m.pushes, deviceToken)
+	} else {
+		m.pushes[deviceToken] = pushes
+	}
+	c.mu.Unlock()
+
+	if exceeded {
+		c.logf("apns2: more than %d Live Activity updates pushed to device token %s within an hour; frequent updates require the NSSupportsLiveActivitiesFrequentUpdates entitlement", m.perHour, maskToken(deviceToken))
+	}
+}
+
+// sweep forgets, at most once an hour, the device tokens with no push or
+// warning after cutoff, so that the records of a long-running Client do not
+// grow with every token it has ever pushed to.
+func (m *updateMonitor) sweep(now, cutoff time.Time) {
+	if now.Sub(m.lastSweep) < time.Hour {
+		return
+	}
+	m.lastSweep = now
+	for token, pushes := range m.pushes {
+		if !pushes[len(pushes)-1].After(cutoff) {
+			delete(m.pushes, token)
+		}
+	}
+	for token, warned := range m.warned {
+		if !warned.After(cutoff) {
+			delete(m.warned, token)
+		}
+	}
+}
+
+// channelLimiter spaces broadcasts to each channel by a minimum interval.
+type channelLimiter struct {
+	interval time.Duration
+	next     map[string]time.Time
+}
+
+// WithChannelRateLimit makes the Client space out broadcasts to a single
+// channel so that at most one is sent every interval. A broadcast to a
+// channel that was pushed to less than interval ago waits for its turn, or
+// until its context is done, before it is sent. Broadcasts to other channels
+// are not held up. APNs throttles channels that are updated too often, in the
+// same way it does device tokens. An interval of zero removes the limit.
+func (c *Client) WithChannelRateLimit(interval time.Duration) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.channels = nil
+	if interval > 0 {
+		c.channels = &channelLimiter{
+			interval: interval,
+			next:     map[string]time.Time{},
+		}
+	}
+	return c
+}
+
+// reserveChannel claims the next send slot for the channel, returning how
+// long to wait until it begins and a function which gives the slot back if
+// the broadcast is abandoned while waiting for it. Channels whose last slot
+// has passed are forgotten.
+func (c *Client) reserveChannel(channelID string) (time.Duration, func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l := c.channels
+	if l == nil {
+		return 0, func() {}
+	}
+	now := c.now()
+	for id, next := range l.next {
+		if !next.After(now) {
+			delete(l.next, id)
+		}
+	}
+	slot := l.next[channelID]
+	if slot.Before(now) {
+		slot = now
+	}
+	end := slot.Add(l.interval)
+	l.next[channelID] = end
+	release := func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// Only the latest slot can be given back; the slots of broadcasts
+		// queued behind it keep their place.
+		if l.next[channelID].Equal(end) {
+			l.next[channelID] = slot
+		}
+	}
+	return slot.Sub(now), release
+}
@@ -0,0 +1,171 @@
+package apns2_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apns "github.com/mkc-bill/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrequentUpdatesWarning(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	var buf bytes.Buffer
+	client := mockClient(server.URL).WithLogger(log.New(&buf, "", 0)).WithFrequentUpdatesWarning(2)
+
+	n := mockNotification()
+	n.PushType = apns.LiveActivity
+	client.Push(n)
+	client.Push(n)
+	assert.Equal(t, "", buf.String())
+
+	client.Push(n)
+	assert.Contains(t, buf.String(), "more than 2 Live Activity updates")
+	assert.Contains(t, buf.String(), "11aa...9ef7")
+	assert.NotContains(t, buf.String(), n.DeviceToken)
+
+	client.Push(n)
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+}
+
+func TestFrequentUpdatesWarningForgetsAfterAnHour(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	var buf bytes.Buffer
+	clock := mockClock(1680000000)
+	client := mockClient(server.URL).WithClock(clock).WithLogger(log.New(&buf, "", 0)).WithFrequentUpdatesWarning(2)
+
+	n := mockNotification()
+	n.PushType = apns.LiveActivity
+	for i := 0; i < 4; i++ {
+		client.Push(n)
+	}
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+
+	clock.Advance(61 * time.Minute)
+	client.Push(n)
+	client.Push(n)
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+	client.Push(n)
+	assert.Equal(t, 2, strings.Count(buf.String(), "\n"))
+}
+
+func TestFrequentUpdatesWarningCountsOnlySentPushes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("apns-topic") == "com.example.bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason":"BadTopic"}`))
+		}
+	}))
+	defer server.Close()
+	var buf bytes.Buffer
+	client := mockClient(server.URL).WithLogger(log.New(&buf, "", 0)).WithFrequentUpdatesWarning(1)
+
+	n := mockNotification()
+	n.PushType = apns.LiveActivity
+	n.Topic = "com.example.bad"
+	client.Push(n)
+	client.Push(n)
+	assert.Equal(t, "", buf.String())
+
+	n.Topic = "com.example.good"
+	client.WithDedup(time.Minute)
+	client.Push(n)
+	client.Push(n)
+	assert.Equal(t, "", buf.String())
+}
+
+func TestFrequentUpdatesWarningIgnoresOtherPushTypes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	var buf bytes.Buffer
+	client := mockClient(server.URL).WithLogger(log.New(&buf, "", 0)).WithFrequentUpdatesWarning(1)
+
+	n := mockNotification()
+	client.Push(n)
+	client.Push(n)
+	assert.Equal(t, "", buf.String())
+}
+
+func TestChannelRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	sent := map[string][]time.Time{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		channel := r.Header.Get("apns-channel-id")
+		sent[channel] = append(sent[channel], time.Now())
+		mu.Unlock()
+	}))
+	defer server.Close()
+	client := mockClient(server.URL).WithChannelRateLimit(50 * time.Millisecond)
+
+	broadcast := func(channel string) {
+		n := mockNotification()
+		n.ChannelID = channel
+		_, err := client.Push(n)
+		assert.NoError(t, err)
+	}
+	start := time.Now()
+	broadcast("dHN0LXNyY2gtY2hubA==")
+	broadcast("dHN0LXNyY2gtY2hubA==")
+	broadcast("b3RoZXItY2hhbm5lbA==")
+
+	first, other := sent["dHN0LXNyY2gtY2hubA=="], sent["b3RoZXItY2hhbm5lbA=="]
+	assert.Len(t, first, 2)
+	assert.True(t, first[1].Sub(first[0]) >= 45*time.Millisecond)
+	assert.Len(t, other, 1)
+	assert.True(t, other[0].Sub(first[1]) < 45*time.Millisecond)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+}
+
+func TestChannelRateLimitContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client := mockClient(server.URL).WithChannelRateLimit(time.Hour)
+
+	n := mockNotification()
+	n.ChannelID = "dHN0LXNyY2gtY2hubA=="
+	_, err := client.Push(n)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = client.PushWithContext(ctx, n)
+	var netErr *apns.NetworkError
+	assert.True(t, errors.As(err, &netErr))
+}
+
+func TestChannelRateLimitReleasesCancelledSlot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	clock := mockClock(1680000000)
+	client := mockClient(server.URL).WithClock(clock).WithChannelRateLimit(time.Hour)
+
+	n := mockNotification()
+	n.ChannelID = "dHN0LXNyY2gtY2hubA=="
+	_, err := client.Push(n)
+	assert.NoError(t, err)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.PushWithContext(cancelled, n)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	// Once the first broadcast's hour has passed on the Client clock, the
+	// next is sent at once rather than waiting behind the abandoned one.
+	clock.Advance(time.Hour)
+	ctx, cancelTimeout := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTimeout()
+	res, err := client.PushWithContext(ctx, n)
+	assert.NoError(t, err)
+	assert.True(t, res.Sent())
+}
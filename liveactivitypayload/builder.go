@@ -3,48 +3,108 @@
 package liveacvititypayload
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mkc-bill/apns2/payload"
+)
+
+// Possible errors when validating a Live Activity payload.
+var (
+	ErrInvalidEvent             = errors.New("liveactivitypayload: event must be start, update or end")
+	ErrTimestampRequired        = errors.New("liveactivitypayload: timestamp is required")
+	ErrContentStateRequired     = errors.New("liveactivitypayload: content-state is required")
+	ErrAttributesRequired       = errors.New("liveactivitypayload: attributes-type and attributes are required to start a Live Activity")
+	ErrInvalidUTF8              = errors.New("liveactivitypayload: alert text is not valid UTF-8")
+	ErrPayloadTooLarge          = errors.New("liveactivitypayload: payload exceeds the maximum size")
+	ErrContentStateTooDeep      = errors.New("liveactivitypayload: content-state is nested too deeply")
+	ErrInvalidInterruptionLevel = payload.ErrInvalidInterruptionLevel
+	ErrRequiredFieldMissing     = errors.New("liveactivitypayload: content-state is missing a required field")
 )
 
-// InterruptionLevel defines the value for the payload aps interruption-level
-type EInterruptionLevel string
+// DefaultMaxSize is the maximum size in bytes APNs accepts for a Live
+// Activity payload, whatever its event.
+const DefaultMaxSize = 4096
+
+// DefaultMaxDepth is the deepest nesting of objects and arrays allowed in a
+// content-state unless set otherwise with MaxDepth.
+const DefaultMaxDepth = 32
+
+// InterruptionLevel defines the value for the payload aps interruption-level.
+// It is the same type as in the payload package, so levels can be shared
+// between alert and Live Activity payloads.
+type EInterruptionLevel = payload.EInterruptionLevel
 
 const (
 	// InterruptionLevelPassive is used to indicate that notification be delivered in a passive manner.
-	InterruptionLevelPassive EInterruptionLevel = "passive"
+	InterruptionLevelPassive = payload.InterruptionLevelPassive
 
 	// InterruptionLevelActive is used to indicate the importance and delivery timing of a notification.
-	InterruptionLevelActive EInterruptionLevel = "active"
+	InterruptionLevelActive = payload.InterruptionLevelActive
 
 	// InterruptionLevelTimeSensitive is used to indicate the importance and delivery timing of a notification.
-	InterruptionLevelTimeSensitive EInterruptionLevel = "time-sensitive"
+	InterruptionLevelTimeSensitive = payload.InterruptionLevelTimeSensitive
 
 	// InterruptionLevelCritical is used to indicate the importance and delivery timing of a notification.
 	// This interruption level requires an approved entitlement from Apple.
 	// See: https://developer.apple.com/documentation/usernotifications/unnotificationinterruptionlevel/
-	InterruptionLevelCritical EInterruptionLevel = "critical"
+	InterruptionLevelCritical = payload.InterruptionLevelCritical
 )
 
+// ParseInterruptionLevel returns the interruption level named s, as
+// payload.ParseInterruptionLevel does.
+func ParseInterruptionLevel(s string) (EInterruptionLevel, error) {
+	return payload.ParseInterruptionLevel(s)
+}
+
 // Payload represents a notification which holds the content that will be
 // marshalled as JSON.
 type Payload struct {
-	content map[string]interface{}
+	content      map[string]interface{}
+	noEscapeHTML bool
+	timestampNow bool
+	dismissAfter time.Duration
+	relDismissal bool
+	strict       bool
+	maxSize      int
+	maxDepth     int
+	unixTimes    bool
+	wholeNumbers bool
+	customAps    map[string]interface{}
+	allowed      map[string]bool
+	required     []string
 }
 
 type aps struct {
-	Alert          interface{} `json:"alert,omitempty"`
-	Timestamp      int64       `json:"timestamp"`
-	Event          string      `json:"event"`
-	ContentState   interface{} `json:"content-state"`
-	AttributesType string      `json:"attributes-type"`
-	Attributes     interface{} `json:"attributes,omitempty"`
-	DismissalDate  int64       `json:"dismissal-date,omitempty"`
+	Alert             interface{}        `json:"alert,omitempty"`
+	Sound             interface{}        `json:"sound,omitempty"`
+	InterruptionLevel EInterruptionLevel `json:"interruption-level,omitempty"`
+	Timestamp         int64              `json:"timestamp,omitempty"`
+	Event             string             `json:"event,omitempty"`
+	ContentState      interface{}        `json:"content-state,omitempty"`
+	AttributesType    string             `json:"attributes-type,omitempty"`
+	Attributes        interface{}        `json:"attributes,omitempty"`
+	DismissalDate     int64              `json:"dismissal-date,omitempty"`
+	FilterCriteria    string             `json:"filter-criteria,omitempty"`
+}
+
+type sound struct {
+	Critical int     `json:"critical,omitempty"`
+	Name     string  `json:"name,omitempty"`
+	Volume   float64 `json:"volume,omitempty"`
 }
 
 // NewPayload returns a new Payload struct
 func NewPayload() *Payload {
 	return &Payload{
-		map[string]interface{}{
+		content: map[string]interface{}{
 			"aps": &aps{},
 		},
 	}
@@ -59,6 +119,45 @@ func (p *Payload) Alert(alert interface{}) *Payload {
 	return p
 }
 
+// ClearAlert removes the aps alert from the payload.
+// This turns an alerting update template into a silent one.
+//
+//	{"aps":{}}
+func (p *Payload) ClearAlert() *Payload {
+	p.aps().Alert = nil
+	return p
+}
+
+// Sound sets the aps sound on the payload, played when an update with an
+// alert is delivered.
+//
+//	{"aps":{"sound":sound}}
+func (p *Payload) Sound(sound interface{}) *Payload {
+	p.aps().Sound = sound
+	return p
+}
+
+// InterruptionLevel sets the aps interruption-level on the payload.
+// (Using InterruptionLevelCritical requires an approved entitlement from Apple.)
+//
+//	{"aps":{"interruption-level":interruptionLevel}}
+func (p *Payload) InterruptionLevel(interruptionLevel EInterruptionLevel) *Payload {
+	p.aps().InterruptionLevel = interruptionLevel
+	return p
+}
+
+// CriticalAlert sets the aps sound on the payload to a critical sound with the
+// given name and volume, between 0 and 1, and the interruption-level to
+// critical, so the alert plays even when the device is muted or in Do Not
+// Disturb. Critical alerts require an approved entitlement from Apple.
+//
+//	{"aps":{"sound":{"critical":1,"name":name,"volume":volume},"interruption-level":"critical"}}
+func (p *Payload) CriticalAlert(name string, volume float64) *Payload {
+	p.aps().Sound = &sound{Critical: 1, Name: name, Volume: volume}
+	p.aps().InterruptionLevel = InterruptionLevelCritical
+	return p
+}
+
 // Custom payload
 
 // Custom sets a custom key and value on the payload.
@@ -70,6 +169,43 @@ func (p *Payload) Custom(key string, val interface{}) *Payload {
 	return p
 }
 
+// CustomAps sets a custom key and value inside the aps dictionary of the
+// payload, alongside the keys defined by Apple. Keys the builder manages,
+// such as event or content-state, are reserved and ignored here.
+//
+//	{"aps":{key:val}}
+func (p *Payload) CustomAps(key string, val interface{}) *Payload {
+	if p.customAps == nil {
+		p.customAps = map[string]interface{}{}
+	}
+	p.customAps[key] = val
+	return p
+}
+
+// ApsBool sets a boolean key inside the aps dictionary, so a key Apple adds
+// for Live Activities, such as content-changed, can be sent before the
+// builder has a setter for it. It is CustomAps with a typed value.
+//
+//	{"aps":{key:v}}
+func (p *Payload) ApsBool(key string, v bool) *Payload {
+	return p.CustomAps(key, v)
+}
+
+// ApsNumber sets a numeric key inside the aps dictionary, like ApsBool.
+//
+//	{"aps":{key:v}}
+func (p *Payload) ApsNumber(key string, v float64) *Payload {
+	return p.CustomAps(key, v)
+}
+
+// APSVersion stamps a payload format version on the aps dictionary, so the
+// app can branch on the format during a gradual content-state migration.
+//
+//	{"aps":{"version":version}}
+func (p *Payload) APSVersion(version string) *Payload {
+	return p.CustomAps("version", version)
+}
+
 // Mdm sets the mdm on the payload.
 // This is for Apple Mobile Device Management (mdm) payloads.
 //
@@ -81,6 +217,18 @@ func (p *Payload) Mdm(mdm string) *Payload {
 
 func (p *Payload) Timestamp(t int64) *Payload {
 	p.aps().Timestamp = t
+	p.timestampNow = false
+	return p
+}
+
+// TimestampNow sets the aps timestamp on the payload to the time it is
+// marshalled, rather than a fixed value. When pushed through an apns2.Client
+// the client's clock skew, if any, is applied to it.
+//
+//	{"aps":{"timestamp":now}}
+func (p *Payload) TimestampNow() *Payload {
+	p.aps().Timestamp = 0
+	p.timestampNow = true
 	return p
 }
 
@@ -89,34 +237,580 @@ func (p *Payload) Event(event string) *Payload {
 	return p
 }
 
+// Start sets the aps event on the payload to EventStart, starting a new Live
+// Activity. It must be chained with Attributes to describe the activity.
+//
+//	{"aps":{"event":"start"}}
+func (p *Payload) Start() *Payload {
+	p.aps().Event = EventStart
+	return p
+}
+
+// CurrentEvent returns the aps event set on the payload by Event, Start or
+// End, or "" if none has been set.
+func (p *Payload) CurrentEvent() string {
+	return p.aps().Event
+}
+
+// End sets the aps event on the payload to EventEnd, ending the Live
+// Activity. It can be chained with ContentState and DismissalDate in any
+// order to supply the final content and when the activity is removed.
+//
+//	{"aps":{"event":"end"}}
+func (p *Payload) End() *Payload {
+	p.aps().Event = EventEnd
+	return p
+}
+
+// EndImmediately sets the aps event on the payload to EventEnd and the
+// dismissal-date to the time the payload is marshalled, so the system removes
+// the Live Activity from the Lock Screen right away rather than keeping it
+// for up to four hours.
+//
+//	{"aps":{"event":"end","dismissal-date":now}}
+func (p *Payload) EndImmediately() *Payload {
+	return p.EndAfter(p.aps().ContentState, 0)
+}
+
+// EndOnly turns the payload into the minimal end event which just dismisses
+// the Live Activity at dismissalDate: the aps event is set to EventEnd and
+// any content-state is removed, so the key is omitted rather than sent as
+// null. If no timestamp has been set, the payload is stamped with the time it
+// is marshalled, as with TimestampNow, so that it passes Validate.
+//
+//	{"aps":{"timestamp":now,"event":"end","dismissal-date":dismissalDate}}
+func (p *Payload) EndOnly(dismissalDate int64) *Payload {
+	a := p.aps()
+	a.Event = EventEnd
+	a.ContentState = nil
+	a.DismissalDate = dismissalDate
+	p.relDismissal = false
+	if a.Timestamp == 0 {
+		p.timestampNow = true
+	}
+	return p
+}
+
+// EndAfter sets the aps event on the payload to EventEnd with the final
+// content-state, and sets the dismissal-date to ttl after the payload is
+// marshalled, so the final state stays on the Lock Screen for ttl before the
+// system removes it. As with TimestampNow, the dismissal-date is resolved
+// each time the payload is marshalled, using the time given to MarshalJSONAt.
+// A ttl of zero removes the Live Activity right away, as EndImmediately does.
+//
+//	{"aps":{"event":"end","content-state":finalContentState,"dismissal-date":now+ttl}}
+func (p *Payload) EndAfter(finalContentState interface{}, ttl time.Duration) *Payload {
+	p.aps().Event = EventEnd
+	p.aps().ContentState = finalContentState
+	p.aps().DismissalDate = 0
+	p.dismissAfter = ttl
+	p.relDismissal = true
+	return p
+}
+
 func (p *Payload) ContentState(contentState interface{}) *Payload {
 	p.aps().ContentState = contentState
 	return p
 }
 
+// ContentStateStruct sets the content-state on the payload to v, typically
+// the struct mirroring the ContentState of the app's ActivityAttributes, and
+// requires each of the given top-level keys to be present and not null in
+// its marshalled form. Validate and marshalling the payload fail with
+// ErrRequiredFieldMissing otherwise, catching a content-state the app could
+// not decode, such as a pointer field left nil.
+//
+//	{"aps":{"content-state":v}}
+func (p *Payload) ContentStateStruct(v interface{}, required ...string) *Payload {
+	p.aps().ContentState = v
+	p.required = required
+	return p
+}
+
+// ContentStateJSON sets the content-state on the payload to already encoded
+// JSON, which is sent as is. Use it when the content-state arrives as JSON,
+// for example from another service, rather than decoding it into an
+// interface{}, which turns numbers into float64 and silently corrupts
+// integers beyond 2^53 such as large IDs. Marshalling the payload fails if
+// data is not valid JSON.
+//
+//	{"aps":{"content-state":data}}
+func (p *Payload) ContentStateJSON(data []byte) *Payload {
+	p.aps().ContentState = json.RawMessage(append([]byte(nil), data...))
+	return p
+}
+
+// ContentStateAllow restricts the content-state to the given top-level keys
+// when the payload is marshalled, dropping any others, so that internal
+// fields of a struct or map cannot leak to devices by accident. The keys of
+// the filtered content-state are marshalled in alphabetical order. A
+// content-state which does not marshal to a JSON object is left alone.
+func (p *Payload) ContentStateAllow(keys ...string) *Payload {
+	p.allowed = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		p.allowed[key] = true
+	}
+	return p
+}
+
+// UnsetContentState removes the content-state from the payload, so that the
+// key is omitted rather than sent as null. This suits start events which
+// provide attributes but defer the content-state to a later update.
+//
+//	{"aps":{}}
+func (p *Payload) UnsetContentState() *Payload {
+	p.aps().ContentState = nil
+	return p
+}
+
+// EmptyContentState sets the content-state on the payload to an empty object,
+// so that the key is present but carries no fields. Use it for events where
+// the key must be sent even though there is no state to update.
+//
+//	{"aps":{"content-state":{}}}
+func (p *Payload) EmptyContentState() *Payload {
+	p.aps().ContentState = map[string]interface{}{}
+	return p
+}
+
 func (p *Payload) AttributesType(attributesType string) *Payload {
 	p.aps().AttributesType = attributesType
 	return p
 }
 
-func (p *Payload) Attributes() *Payload {
-	var obj = make(map[string]interface{})
-
-	p.aps().Attributes = obj
+// Attributes sets the aps attributes-type and attributes on the payload
+// together, as both are required to start a Live Activity. The attributes
+// type is the name of the app's ActivityAttributes struct. A nil attributes
+// is sent as an empty object.
+//
+//	{"aps":{"attributes-type":attributesType,"attributes":attributes}}
+func (p *Payload) Attributes(attributesType string, attributes interface{}) *Payload {
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+	p.aps().AttributesType = attributesType
+	p.aps().Attributes = attributes
 	return p
 }
 
 func (p *Payload) DismissalDate(t int64) *Payload {
 
 	p.aps().DismissalDate = t
+	p.relDismissal = false
+	return p
+}
+
+// FilterCriteria sets the aps filter-criteria on the payload. On a broadcast
+// channel, only devices which opted into matching criteria receive the
+// update, so one broadcast can target a subset of its subscribers.
+//
+//	{"aps":{"filter-criteria":criteria}}
+func (p *Payload) FilterCriteria(criteria string) *Payload {
+	p.aps().FilterCriteria = criteria
+	return p
+}
+
+// SizeByKey returns the approximate number of bytes each top-level key of the
+// content-state contributes to the marshalled payload, including the key
+// itself. This helps find which fields to trim when a payload is too large.
+// It returns nil if the content-state is unset or does not marshal to a JSON
+// object.
+func (p *Payload) SizeByKey() map[string]int {
+	state := p.aps().ContentState
+	if state == nil {
+		return nil
+	}
+	if p.allowed != nil {
+		state = p.filterContentState(state)
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil
+	}
+	sizes := make(map[string]int, len(fields))
+	for key, value := range fields {
+		k, _ := json.Marshal(key)
+		sizes[key] = len(k) + 1 + len(value)
+	}
+	return sizes
+}
+
+// ContentStateBudget returns the number of bytes left for the encoded
+// content-state once the rest of the payload is accounted for, within the
+// maximum size for its event set with MaxSize or DefaultMaxSize. It can be
+// used to trim a dynamic content-state, such as a list of recent events, to
+// fit. The result is negative if the rest of the payload alone is too large,
+// and 0 if the payload cannot be marshalled.
+func (p *Payload) ContentStateBudget() int {
+	a := *p.aps()
+	a.ContentState = json.RawMessage("{}")
+	q := *p
+	q.content = make(map[string]interface{}, len(p.content))
+	for key, value := range p.content {
+		q.content[key] = value
+	}
+	q.content["aps"] = &a
+	b, err := q.marshal(q.contentAt(time.Now()))
+	if err != nil {
+		return 0
+	}
+	return p.limit() - (len(b) - len("{}"))
+}
+
+// HasAlert reports whether an alert has been set on the payload.
+func (p *Payload) HasAlert() bool {
+	return p.aps().Alert != nil
+}
+
+// Validate checks the payload against the rules APNs applies to Live Activity
+// notifications. The event must be one of EventStart, EventUpdate or EventEnd
+// and a timestamp must be set. A start must carry the attributes-type and
+// attributes of the activity. An update must carry a content-state, and may
+// also carry an alert to notify the user of the change. Alert text must be
+// valid UTF-8.
+func (p *Payload) Validate() error {
+	a := p.aps()
+	switch a.Event {
+	case EventStart:
+		if a.AttributesType == "" || a.Attributes == nil {
+			return ErrAttributesRequired
+		}
+	case EventEnd:
+	case EventUpdate:
+		if a.ContentState == nil {
+			return ErrContentStateRequired
+		}
+	default:
+		return ErrInvalidEvent
+	}
+	if a.Timestamp == 0 && !p.timestampNow {
+		return ErrTimestampRequired
+	}
+	if err := p.checkRequired(); err != nil {
+		return err
+	}
+	return validateAlertUTF8(a.Alert)
+}
+
+// DisableHTMLEscape stops the characters <, > and & from being escaped as
+// \u003c, \u003e and \u0026 when the payload is marshalled, so alert text
+// containing URLs or symbols is sent as written. By default they are escaped,
+// as with json.Marshal.
+func (p *Payload) DisableHTMLEscape() *Payload {
+	p.noEscapeHTML = true
+	return p
+}
+
+// Strict makes marshalling the payload fail with ErrPayloadTooLarge if the
+// result exceeds the maximum size for its event, so an oversized payload is
+// caught before it is sent rather than rejected by APNs.
+func (p *Payload) Strict() *Payload {
+	p.strict = true
+	return p
+}
+
+// MaxSize sets the maximum size in bytes enforced by Strict, in place of
+// DefaultMaxSize.
+func (p *Payload) MaxSize(n int) *Payload {
+	p.maxSize = n
+	return p
+}
+
+// MaxDepth sets the deepest nesting of objects and arrays allowed in the
+// content-state, in place of DefaultMaxDepth. Marshalling a payload whose
+// content-state is nested more deeply, or refers back to itself, fails with
+// ErrContentStateTooDeep rather than running away. A content-state set with
+// ContentStateJSON is not checked, as it is already encoded.
+func (p *Payload) MaxDepth(n int) *Payload {
+	p.maxDepth = n
 	return p
 }
 
 // MarshalJSON returns the JSON encoded version of the Payload
 func (p *Payload) MarshalJSON() ([]byte, error) {
-	return json.Marshal(p.content)
+	return p.MarshalJSONAt(time.Now())
+}
+
+// MarshalJSONAt returns the JSON encoded version of the Payload, using now as
+// the timestamp if TimestampNow was set. The payload itself is not modified.
+func (p *Payload) MarshalJSONAt(now time.Time) ([]byte, error) {
+	if max := p.depthLimit(); tooDeep(reflect.ValueOf(p.aps().ContentState), max) {
+		return nil, fmt.Errorf("%w: more than %d levels", ErrContentStateTooDeep, max)
+	}
+	if err := p.checkRequired(); err != nil {
+		return nil, err
+	}
+	b, err := p.marshal(p.contentAt(now))
+	if err != nil {
+		return nil, err
+	}
+	if max := p.limit(); p.strict && len(b) > max {
+		return nil, fmt.Errorf("%w: %s payload is %d bytes, maximum %d", ErrPayloadTooLarge, p.aps().Event, len(b), max)
+	}
+	return b, nil
+}
+
+// Snapshot returns a deep copy of the payload content as it would be sent now,
+// decoded from its JSON encoding, for audit logging or storage. Later changes
+// to the builder or the values passed to it do not affect the snapshot.
+// Numbers are returned as json.Number so that their exact value is kept. It
+// returns nil if the payload cannot be marshalled.
+func (p *Payload) Snapshot() map[string]interface{} {
+	b, err := p.marshal(p.contentAt(time.Now()))
+	if err != nil {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var snapshot map[string]interface{}
+	if err := decoder.Decode(&snapshot); err != nil {
+		return nil
+	}
+	return snapshot
+}
+
+// contentAt returns the payload content with a TimestampNow timestamp
+// resolved to now, leaving the payload itself unchanged.
+func (p *Payload) contentAt(now time.Time) map[string]interface{} {
+	if !p.timestampNow && !p.relDismissal && len(p.customAps) == 0 && p.allowed == nil && !p.unixTimes && !p.wholeNumbers {
+		return p.content
+	}
+	a := *p.aps()
+	if p.timestampNow {
+		a.Timestamp = now.Unix()
+	}
+	if p.relDismissal {
+		a.DismissalDate = now.Add(p.dismissAfter).Unix()
+	}
+	if p.unixTimes && a.ContentState != nil {
+		a.ContentState = withUnixTimes(reflect.ValueOf(a.ContentState), !p.noEscapeHTML)
+	}
+	if p.wholeNumbers && a.ContentState != nil {
+		a.ContentState = withWholeNumbers(a.ContentState, !p.noEscapeHTML)
+	}
+	if p.allowed != nil && a.ContentState != nil {
+		a.ContentState = p.filterContentState(a.ContentState)
+	}
+	content := make(map[string]interface{}, len(p.content))
+	for key, value := range p.content {
+		content[key] = value
+	}
+	content["aps"] = &a
+	if len(p.customAps) > 0 {
+		content["aps"] = &apsWithCustom{aps: &a, custom: p.customAps, escapeHTML: !p.noEscapeHTML}
+	}
+	return content
+}
+
+// checkRequired returns ErrRequiredFieldMissing if a content-state is set
+// without one of the keys required by ContentStateStruct, after any
+// ContentStateAllow filtering.
+func (p *Payload) checkRequired() error {
+	state := p.aps().ContentState
+	if len(p.required) == 0 || state == nil {
+		return nil
+	}
+	if p.allowed != nil {
+		state = p.filterContentState(state)
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	json.Unmarshal(b, &fields)
+	for _, key := range p.required {
+		if value, ok := fields[key]; !ok || string(value) == "null" {
+			return fmt.Errorf("%w: %s", ErrRequiredFieldMissing, key)
+		}
+	}
+	return nil
+}
+
+// filterContentState returns the content-state with only the allowed keys.
+func (p *Payload) filterContentState(state interface{}) interface{} {
+	b, err := encode(state, !p.noEscapeHTML)
+	if err != nil {
+		return state
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return state
+	}
+	for key := range fields {
+		if !p.allowed[key] {
+			delete(fields, key)
+		}
+	}
+	return fields
+}
+
+func (p *Payload) marshal(content map[string]interface{}) ([]byte, error) {
+	return encode(content, !p.noEscapeHTML)
+}
+
+// apsWithCustom marshals an aps dictionary followed by the custom keys set
+// with CustomAps, in key order.
+type apsWithCustom struct {
+	aps        *aps
+	custom     map[string]interface{}
+	escapeHTML bool
+}
+
+func (a *apsWithCustom) MarshalJSON() ([]byte, error) {
+	b, err := encode(a.aps, a.escapeHTML)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(a.custom))
+	for key := range a.custom {
+		if !reservedApsKeys[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	buf := bytes.NewBuffer(bytes.TrimSuffix(b, []byte("}")))
+	for i, key := range keys {
+		if i > 0 || len(b) > 2 {
+			buf.WriteByte(',')
+		}
+		k, _ := encode(key, a.escapeHTML)
+		v, err := encode(a.custom[key], a.escapeHTML)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// reservedApsKeys are the aps keys managed by the builder.
+var reservedApsKeys = func() map[string]bool {
+	keys := map[string]bool{}
+	t := reflect.TypeOf(aps{})
+	for i := 0; i < t.NumField(); i++ {
+		keys[strings.Split(t.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+	return keys
+}()
+
+// encode marshals v as JSON, escaping HTML characters only if escapeHTML is
+// set.
+func encode(v interface{}, escapeHTML bool) ([]byte, error) {
+	if escapeHTML {
+		return json.Marshal(v)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// limit returns the maximum size of the payload for its event.
+func (p *Payload) limit() int {
+	if p.maxSize > 0 {
+		return p.maxSize
+	}
+	return DefaultMaxSize
+}
+
+// depthLimit returns the deepest nesting allowed in the content-state.
+func (p *Payload) depthLimit() int {
+	if p.maxDepth > 0 {
+		return p.maxDepth
+	}
+	return DefaultMaxDepth
+}
+
+// tooDeep reports whether v nests objects and arrays more than max levels
+// deep. Following a pointer is free unless it leads to another pointer or
+// interface, so that a value which refers back to itself is caught too.
+// Unexported struct fields are skipped, as they are not marshalled.
+func tooDeep(v reflect.Value, max int) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return false
+		}
+		elem := v.Elem()
+		if elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Interface {
+			if max == 0 {
+				return true
+			}
+			max--
+		}
+		return tooDeep(elem, max)
+	case reflect.Map:
+		if max == 0 {
+			return true
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if tooDeep(iter.Value(), max-1) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return false
+		}
+		if max == 0 {
+			return true
+		}
+		for i := 0; i < v.Len(); i++ {
+			if tooDeep(v.Index(i), max-1) {
+				return true
+			}
+		}
+	case reflect.Struct:
+		if max == 0 {
+			return true
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if tooDeep(v.Field(i), max-1) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (p *Payload) aps() *aps {
 	return p.content["aps"].(*aps)
 }
+
+func validateAlertUTF8(alert interface{}) error {
+	switch a := alert.(type) {
+	case string:
+		if !utf8.ValidString(a) {
+			return fmt.Errorf("%w: alert", ErrInvalidUTF8)
+		}
+	case map[string]string:
+		for key, value := range a {
+			if !utf8.ValidString(value) {
+				return fmt.Errorf("%w: alert %s", ErrInvalidUTF8, key)
+			}
+		}
+	case map[string]interface{}:
+		for key, value := range a {
+			if str, ok := value.(string); ok && !utf8.ValidString(str) {
+				return fmt.Errorf("%w: alert %s", ErrInvalidUTF8, key)
+			}
+		}
+	}
+	return nil
+}
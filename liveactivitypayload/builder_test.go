@@ -2,9 +2,13 @@ package liveacvititypayload_test
 
 import (
 	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
 	. "github.com/mkc-bill/apns2/liveactivitypayload"
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 func TestEmptyPayload(t *testing.T) {
@@ -19,6 +23,13 @@ func TestAlert(t *testing.T) {
 	assert.Equal(t, `{"aps":{"alert":"hello"}}`, string(b))
 }
 
+func TestClearAlert(t *testing.T) {
+	payload := NewPayload().Alert("hello").Event(EventUpdate).ClearAlert()
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"event":"update"}}`, string(b))
+	assert.False(t, payload.HasAlert())
+}
+
 func TestCustom(t *testing.T) {
 	payload := NewPayload().Custom("key", "val")
 	b, _ := json.Marshal(payload)
@@ -38,3 +49,428 @@ func TestMdm(t *testing.T) {
 	b, _ := json.Marshal(payload)
 	assert.Equal(t, `{"aps":{},"mdm":"996ac527-9993-4a0a-8528-60b2b3c2f52b"}`, string(b))
 }
+
+func TestUpdateWithAlert(t *testing.T) {
+	payload := NewPayload().
+		Event(EventUpdate).
+		Timestamp(1680000000).
+		ContentState(map[string]interface{}{"score": 2}).
+		Alert(map[string]interface{}{"title": "Goal!", "body": "Home scores"})
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"alert":{"body":"Home scores","title":"Goal!"},"timestamp":1680000000,"event":"update","content-state":{"score":2}}}`, string(b))
+	assert.True(t, payload.HasAlert())
+	assert.NoError(t, payload.Validate())
+}
+
+func TestValidate(t *testing.T) {
+	scenarios := []struct {
+		payload *Payload
+		err     error
+	}{
+		{NewPayload().Timestamp(1), ErrInvalidEvent},
+		{NewPayload().Event("pause").Timestamp(1), ErrInvalidEvent},
+		{NewPayload().Event(EventUpdate).ContentState(map[string]interface{}{}), ErrTimestampRequired},
+		{NewPayload().Event(EventUpdate).Timestamp(1), ErrContentStateRequired},
+		{NewPayload().Event(EventUpdate).Timestamp(1).ContentState(map[string]interface{}{}), nil},
+		{NewPayload().Event(EventEnd).Timestamp(1), nil},
+		{NewPayload().Event(EventStart).Timestamp(1), ErrAttributesRequired},
+		{NewPayload().Event(EventStart).Timestamp(1).Attributes("", map[string]interface{}{"team": "home"}), ErrAttributesRequired},
+		{NewPayload().Event(EventStart).Timestamp(1).AttributesType("Score"), ErrAttributesRequired},
+		{NewPayload().Event(EventStart).Timestamp(1).Attributes("Score", nil), nil},
+	}
+	for _, scenario := range scenarios {
+		assert.Equal(t, scenario.err, scenario.payload.Validate())
+	}
+}
+
+func TestValidateInvalidUTF8(t *testing.T) {
+	base := func() *Payload {
+		return NewPayload().Event(EventUpdate).Timestamp(1).ContentState(map[string]interface{}{})
+	}
+	for _, alert := range []interface{}{
+		"bad \xff",
+		map[string]string{"title": "bad \xc3\x28"},
+		map[string]interface{}{"body": "bad \xe2\x82"},
+	} {
+		err := base().Alert(alert).Validate()
+		assert.True(t, errors.Is(err, ErrInvalidUTF8))
+	}
+}
+
+func TestEscapeHTMLByDefault(t *testing.T) {
+	payload := NewPayload().Alert("Tom & Jerry <3")
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"alert":"Tom \u0026 Jerry \u003c3"}}`, string(b))
+}
+
+func TestDisableHTMLEscape(t *testing.T) {
+	payload := NewPayload().Alert("Tom & Jerry <3").DisableHTMLEscape()
+	b, err := payload.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"aps":{"alert":"Tom & Jerry <3"}}`, string(b))
+}
+
+func TestEnd(t *testing.T) {
+	payload := NewPayload().End().DismissalDate(1680000600)
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"event":"end","dismissal-date":1680000600}}`, string(b))
+}
+
+func TestEndAnyOrder(t *testing.T) {
+	state := map[string]interface{}{"score": 3}
+	a, _ := json.Marshal(NewPayload().End().ContentState(state).DismissalDate(1680000600))
+	b, _ := json.Marshal(NewPayload().DismissalDate(1680000600).ContentState(state).End())
+	assert.Equal(t, string(a), string(b))
+	assert.Equal(t, `{"aps":{"event":"end","content-state":{"score":3},"dismissal-date":1680000600}}`, string(a))
+}
+
+func TestSizeByKey(t *testing.T) {
+	payload := NewPayload().ContentState(map[string]interface{}{
+		"score":   1,
+		"summary": strings.Repeat("x", 500),
+		"team":    "home",
+	})
+	sizes := payload.SizeByKey()
+	assert.Equal(t, len(`"score":1`), sizes["score"])
+	assert.Equal(t, len(`"team":"home"`), sizes["team"])
+
+	largest := ""
+	for key, size := range sizes {
+		if size > sizes[largest] {
+			largest = key
+		}
+	}
+	assert.Equal(t, "summary", largest)
+}
+
+func TestSizeByKeyWithoutContentState(t *testing.T) {
+	assert.Nil(t, NewPayload().SizeByKey())
+	assert.Nil(t, NewPayload().ContentState([]int{1, 2}).SizeByKey())
+}
+
+func TestContentStateOmittedWhenUnset(t *testing.T) {
+	payload := NewPayload().Event(EventStart).Attributes("Score", nil)
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"event":"start","attributes-type":"Score","attributes":{}}}`, string(b))
+}
+
+func TestUnsetContentState(t *testing.T) {
+	payload := NewPayload().Event(EventStart).ContentState(map[string]interface{}{"score": 1}).UnsetContentState()
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"event":"start"}}`, string(b))
+}
+
+func TestEmptyContentState(t *testing.T) {
+	payload := NewPayload().Event(EventUpdate).Timestamp(1).EmptyContentState()
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"timestamp":1,"event":"update","content-state":{}}}`, string(b))
+	assert.NoError(t, payload.Validate())
+}
+
+func TestAttributes(t *testing.T) {
+	payload := NewPayload().Attributes("MatchAttributes", map[string]interface{}{"home": "Reds", "away": "Blues"})
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"attributes-type":"MatchAttributes","attributes":{"away":"Blues","home":"Reds"}}}`, string(b))
+}
+
+func TestFilterCriteria(t *testing.T) {
+	payload := NewPayload().Event(EventUpdate).FilterCriteria("premium")
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"event":"update","filter-criteria":"premium"}}`, string(b))
+}
+
+func TestTimestampNow(t *testing.T) {
+	payload := NewPayload().Event(EventEnd).TimestampNow()
+	assert.NoError(t, payload.Validate())
+
+	b, err := payload.MarshalJSONAt(time.Unix(1680000000, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"aps":{"timestamp":1680000000,"event":"end"}}`, string(b))
+
+	b, _ = payload.Timestamp(5).MarshalJSONAt(time.Unix(1680000000, 0))
+	assert.Equal(t, `{"aps":{"timestamp":5,"event":"end"}}`, string(b))
+}
+
+func TestStrictPayloadTooLarge(t *testing.T) {
+	state := map[string]string{"text": strings.Repeat("a", DefaultMaxSize)}
+	payload := NewPayload().Event(EventUpdate).Timestamp(1).ContentState(state)
+	_, err := json.Marshal(payload)
+	assert.NoError(t, err)
+
+	_, err = payload.Strict().MarshalJSON()
+	assert.True(t, errors.Is(err, ErrPayloadTooLarge))
+	assert.Contains(t, err.Error(), "update payload is 4164 bytes, maximum 4096")
+}
+
+func TestStrictMaxSize(t *testing.T) {
+	payload := NewPayload().Event(EventEnd).Timestamp(1).Strict()
+	_, err := payload.MarshalJSON()
+	assert.NoError(t, err)
+
+	_, err = payload.MaxSize(10).MarshalJSON()
+	assert.True(t, errors.Is(err, ErrPayloadTooLarge))
+}
+
+func TestCriticalAlert(t *testing.T) {
+	payload := NewPayload().Alert("Gate changed").CriticalAlert("chime.aiff", 0.8)
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"alert":"Gate changed","sound":{"critical":1,"name":"chime.aiff","volume":0.8},"interruption-level":"critical"}}`, string(b))
+}
+
+func TestSoundAndInterruptionLevel(t *testing.T) {
+	payload := NewPayload().Sound("default").InterruptionLevel(InterruptionLevelTimeSensitive)
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"sound":"default","interruption-level":"time-sensitive"}}`, string(b))
+}
+
+func TestSnapshot(t *testing.T) {
+	state := map[string]interface{}{"score": 1}
+	payload := NewPayload().Event(EventUpdate).Timestamp(1680000000).ContentState(state).Custom("id", "abc")
+	snapshot := payload.Snapshot()
+
+	state["score"] = 2
+	payload.Event(EventEnd).Custom("id", "xyz")
+
+	expected := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"event":         "update",
+			"timestamp":     json.Number("1680000000"),
+			"content-state": map[string]interface{}{"score": json.Number("1")},
+		},
+		"id": "abc",
+	}
+	assert.Equal(t, expected, snapshot)
+}
+
+func TestCurrentEvent(t *testing.T) {
+	payload := NewPayload()
+	assert.Equal(t, "", payload.CurrentEvent())
+	assert.Equal(t, EventStart, payload.Start().CurrentEvent())
+	assert.Equal(t, EventUpdate, payload.Event(EventUpdate).CurrentEvent())
+	assert.Equal(t, EventEnd, payload.End().CurrentEvent())
+}
+
+func TestContentStateJSONLargeInt(t *testing.T) {
+	payload := NewPayload().Event(EventUpdate).Timestamp(1).ContentStateJSON([]byte(`{"id":9007199254740993}`))
+	b, err := json.Marshal(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"aps":{"timestamp":1,"event":"update","content-state":{"id":9007199254740993}}}`, string(b))
+
+	var decoded struct {
+		Aps struct {
+			ContentState struct {
+				ID int64 `json:"id"`
+			} `json:"content-state"`
+		} `json:"aps"`
+	}
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, int64(9007199254740993), decoded.Aps.ContentState.ID)
+	assert.Equal(t, json.Number("9007199254740993"), payload.Snapshot()["aps"].(map[string]interface{})["content-state"].(map[string]interface{})["id"])
+}
+
+func TestContentStateLargeInt64(t *testing.T) {
+	payload := NewPayload().ContentState(map[string]int64{"id": 9007199254740993})
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"content-state":{"id":9007199254740993}}}`, string(b))
+}
+
+func TestContentStateJSONInvalid(t *testing.T) {
+	_, err := json.Marshal(NewPayload().ContentStateJSON([]byte(`{"id":`)))
+	assert.Error(t, err)
+}
+
+func TestAPSVersion(t *testing.T) {
+	payload := NewPayload().Event(EventUpdate).Timestamp(1).APSVersion("2")
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"timestamp":1,"event":"update","version":"2"}}`, string(b))
+}
+
+func TestCustomAps(t *testing.T) {
+	payload := NewPayload().CustomAps("z", 1).CustomAps("event", "ignored").CustomAps("a", "<b>").DisableHTMLEscape()
+	b, _ := payload.MarshalJSON()
+	assert.Equal(t, `{"aps":{"a":"<b>","z":1}}`, string(b))
+
+	payload.Event(EventEnd)
+	b, _ = payload.MarshalJSON()
+	assert.Equal(t, `{"aps":{"event":"end","a":"<b>","z":1}}`, string(b))
+}
+
+func TestApsBoolAndNumber(t *testing.T) {
+	payload := NewPayload().Event(EventUpdate).ApsBool("content-changed", true).ApsNumber("stale-score", 0.5)
+	b, _ := payload.MarshalJSON()
+	assert.Equal(t, `{"aps":{"event":"update","content-changed":true,"stale-score":0.5}}`, string(b))
+}
+
+func TestContentStateAllow(t *testing.T) {
+	type state struct {
+		Score    int    `json:"score"`
+		Clock    string `json:"clock"`
+		Internal string `json:"internal"`
+	}
+	payload := NewPayload().Event(EventUpdate).ContentState(state{Score: 2, Clock: "81:00", Internal: "db-7"}).ContentStateAllow("score", "clock")
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"event":"update","content-state":{"clock":"81:00","score":2}}}`, string(b))
+
+	payload.ContentState(map[string]interface{}{"score": 3, "secret": true})
+	b, _ = json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"event":"update","content-state":{"score":3}}}`, string(b))
+	assert.Equal(t, map[string]int{"score": 9}, payload.SizeByKey())
+}
+
+func TestContentStateStruct(t *testing.T) {
+	type state struct {
+		Score  int     `json:"score"`
+		Scorer *string `json:"scorer"`
+		Clock  string  `json:"clock,omitempty"`
+	}
+	scorer := "Kane"
+	payload := NewPayload().Event(EventUpdate).Timestamp(1).ContentStateStruct(state{Score: 1, Scorer: &scorer, Clock: "12:00"}, "score", "scorer", "clock")
+	assert.NoError(t, payload.Validate())
+	b, err := payload.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"aps":{"timestamp":1,"event":"update","content-state":{"score":1,"scorer":"Kane","clock":"12:00"}}}`, string(b))
+}
+
+func TestContentStateStructMissingField(t *testing.T) {
+	type state struct {
+		Score  int     `json:"score"`
+		Scorer *string `json:"scorer"`
+		Clock  string  `json:"clock,omitempty"`
+	}
+	payload := NewPayload().Event(EventUpdate).Timestamp(1).ContentStateStruct(state{Score: 1}, "score", "scorer")
+	assert.True(t, errors.Is(payload.Validate(), ErrRequiredFieldMissing))
+	_, err := payload.MarshalJSON()
+	assert.True(t, errors.Is(err, ErrRequiredFieldMissing))
+	assert.Contains(t, err.Error(), "scorer")
+
+	payload.ContentStateStruct(state{Score: 1}, "clock")
+	_, err = payload.MarshalJSON()
+	assert.True(t, errors.Is(err, ErrRequiredFieldMissing))
+	assert.Contains(t, err.Error(), "clock")
+}
+
+func TestEndImmediately(t *testing.T) {
+	payload := NewPayload().Timestamp(1).EndImmediately()
+	b, _ := payload.MarshalJSONAt(time.Unix(1000, 0))
+	assert.Equal(t, `{"aps":{"timestamp":1,"event":"end","dismissal-date":1000}}`, string(b))
+	assert.NoError(t, payload.Validate())
+
+	b, _ = payload.MarshalJSONAt(time.Unix(2000, 0))
+	assert.Equal(t, `{"aps":{"timestamp":1,"event":"end","dismissal-date":2000}}`, string(b))
+}
+
+func TestEndAfter(t *testing.T) {
+	payload := NewPayload().Timestamp(1).EndAfter(map[string]int{"score": 3}, 30*time.Second)
+	b, _ := payload.MarshalJSONAt(time.Unix(1000, 0))
+	assert.Equal(t, `{"aps":{"timestamp":1,"event":"end","content-state":{"score":3},"dismissal-date":1030}}`, string(b))
+	assert.NoError(t, payload.Validate())
+}
+
+func TestEndAfterZeroTTL(t *testing.T) {
+	payload := NewPayload().Timestamp(1).EndAfter(map[string]int{"score": 3}, 0)
+	b, _ := payload.MarshalJSONAt(time.Unix(1000, 0))
+	assert.Equal(t, `{"aps":{"timestamp":1,"event":"end","content-state":{"score":3},"dismissal-date":1000}}`, string(b))
+}
+
+func TestEndAfterThenDismissalDate(t *testing.T) {
+	payload := NewPayload().Timestamp(1).EndAfter(nil, time.Minute).DismissalDate(5000)
+	b, _ := payload.MarshalJSONAt(time.Unix(1000, 0))
+	assert.Equal(t, `{"aps":{"timestamp":1,"event":"end","dismissal-date":5000}}`, string(b))
+}
+
+func TestEndOnly(t *testing.T) {
+	var state map[string]int
+	payload := NewPayload().Timestamp(1).ContentState(state).EndOnly(2000)
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"timestamp":1,"event":"end","dismissal-date":2000}}`, string(b))
+	assert.NoError(t, payload.Validate())
+}
+
+func TestEndOnlyStampsTimestamp(t *testing.T) {
+	payload := NewPayload().EndOnly(2000)
+	assert.NoError(t, payload.Validate())
+	b, _ := payload.MarshalJSONAt(time.Unix(1000, 0))
+	assert.Equal(t, `{"aps":{"timestamp":1000,"event":"end","dismissal-date":2000}}`, string(b))
+}
+
+func nested(depth int) interface{} {
+	var state interface{} = "leaf"
+	for i := 0; i < depth; i++ {
+		state = map[string]interface{}{"next": state}
+	}
+	return state
+}
+
+func TestMaxDepth(t *testing.T) {
+	_, err := json.Marshal(NewPayload().Event(EventUpdate).Timestamp(1).ContentState(nested(DefaultMaxDepth)))
+	assert.NoError(t, err)
+
+	_, err = json.Marshal(NewPayload().Event(EventUpdate).Timestamp(1).ContentState(nested(DefaultMaxDepth + 1)))
+	assert.True(t, errors.Is(err, ErrContentStateTooDeep))
+
+	_, err = json.Marshal(NewPayload().Event(EventUpdate).Timestamp(1).MaxDepth(2).ContentState(nested(3)))
+	assert.True(t, errors.Is(err, ErrContentStateTooDeep))
+}
+
+func TestMaxDepthCycle(t *testing.T) {
+	state := map[string]interface{}{}
+	state["self"] = state
+	_, err := json.Marshal(NewPayload().Event(EventUpdate).Timestamp(1).ContentState(state))
+	assert.True(t, errors.Is(err, ErrContentStateTooDeep))
+
+	var self interface{}
+	self = &self
+	_, err = json.Marshal(NewPayload().Event(EventUpdate).Timestamp(1).ContentState(self))
+	assert.True(t, errors.Is(err, ErrContentStateTooDeep))
+}
+
+func TestParseInterruptionLevel(t *testing.T) {
+	for _, level := range []EInterruptionLevel{
+		InterruptionLevelPassive,
+		InterruptionLevelActive,
+		InterruptionLevelTimeSensitive,
+		InterruptionLevelCritical,
+	} {
+		parsed, err := ParseInterruptionLevel(string(level))
+		assert.NoError(t, err)
+		assert.Equal(t, level, parsed)
+		assert.True(t, parsed.IsValid())
+	}
+}
+
+func TestParseInterruptionLevelUnknown(t *testing.T) {
+	for _, s := range []string{"", "urgent", "Active"} {
+		parsed, err := ParseInterruptionLevel(s)
+		assert.True(t, errors.Is(err, ErrInvalidInterruptionLevel), s)
+		assert.Equal(t, EInterruptionLevel(""), parsed)
+		assert.False(t, EInterruptionLevel(s).IsValid(), s)
+	}
+}
+
+func TestContentStateBudget(t *testing.T) {
+	payload := NewPayload().Event(EventUpdate).Timestamp(1)
+	empty := payload.ContentStateBudget()
+	assert.Equal(t, DefaultMaxSize-len(`{"aps":{"timestamp":1,"event":"update","content-state":}}`), empty)
+
+	payload.Alert(map[string]string{"title": "Goal!"})
+	withAlert := payload.ContentStateBudget()
+	assert.True(t, withAlert < empty)
+
+	payload.ContentState(map[string]int{"home": 1})
+	assert.Equal(t, withAlert, payload.ContentStateBudget())
+
+	payload.MaxSize(2048)
+	assert.Equal(t, withAlert-(DefaultMaxSize-2048), payload.ContentStateBudget())
+}
+
+func TestContentStateBudgetFits(t *testing.T) {
+	payload := NewPayload().Event(EventUpdate).Timestamp(1).Strict()
+	state := strings.Repeat("a", payload.ContentStateBudget()-2)
+	payload.ContentStateJSON([]byte(`"` + state + `"`))
+	_, err := payload.MarshalJSON()
+	assert.NoError(t, err)
+
+	payload.ContentStateJSON([]byte(`"` + state + `a"`))
+	_, err = payload.MarshalJSON()
+	assert.True(t, errors.Is(err, ErrPayloadTooLarge))
+}
@@ -0,0 +1,59 @@
+// Package contentstate contains example content-state structs for common
+// kinds of Live Activity. They can be used as they are, or copied as
+// templates, and show how fields should be tagged to match the Codable
+// ContentState struct of an app, whose property names are used as keys.
+//
+// Pass a value to the ContentState method of the liveactivitypayload builder.
+package contentstate
+
+import liveactivity "github.com/mkc-bill/apns2/liveactivitypayload"
+
+// SportsContentState is the content-state of a Live Activity following a
+// match between two teams.
+type SportsContentState struct {
+	HomeScore int `json:"homeScore"`
+	AwayScore int `json:"awayScore"`
+
+	// The period of play, such as "2nd Half" or "Q3".
+	Period string `json:"period,omitempty"`
+
+	// The match clock, such as "67:12", omitted when it is not running.
+	Clock string `json:"clock,omitempty"`
+
+	// The latest notable event of the match, such as a goal.
+	LastEvent string `json:"lastEvent,omitempty"`
+}
+
+// DeliveryContentState is the content-state of a Live Activity tracking a
+// delivery.
+type DeliveryContentState struct {
+	// The stage of the delivery, such as "preparing" or "on the way".
+	Status string `json:"status"`
+
+	// The estimated time of arrival, as seconds since 1 January 2001, which
+	// is how a Swift Date is decoded by default.
+	EstimatedArrival float64 `json:"estimatedArrival"`
+
+	// The name of the courier, omitted until one is assigned.
+	CourierName string `json:"courierName,omitempty"`
+
+	// The number of stops before this delivery.
+	StopsAway int `json:"stopsAway"`
+}
+
+// ScoreUpdate returns an update payload for a sports Live Activity carrying
+// the new score as a SportsContentState, timestamped when it is marshalled.
+// The sound, if not empty, plays when the update is delivered with an alert,
+// which can be added with the Alert method of the returned payload.
+//
+//	{"aps":{"sound":sound,"timestamp":now,"event":"update","content-state":{"homeScore":home,"awayScore":away}}}
+func ScoreUpdate(home, away int, sound string) *liveactivity.Payload {
+	p := liveactivity.NewPayload().
+		Event(liveactivity.EventUpdate).
+		TimestampNow().
+		ContentState(SportsContentState{HomeScore: home, AwayScore: away})
+	if sound != "" {
+		p.Sound(sound)
+	}
+	return p
+}
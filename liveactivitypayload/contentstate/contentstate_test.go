@@ -0,0 +1,40 @@
+package contentstate_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/mkc-bill/apns2/liveactivitypayload"
+	"github.com/mkc-bill/apns2/liveactivitypayload/contentstate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSportsContentState(t *testing.T) {
+	state := contentstate.SportsContentState{HomeScore: 2, AwayScore: 1, Period: "2nd Half", Clock: "67:12"}
+	payload := NewPayload().Event(EventUpdate).Timestamp(1).ContentState(state)
+	assert.NoError(t, payload.Validate())
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"timestamp":1,"event":"update","content-state":{"homeScore":2,"awayScore":1,"period":"2nd Half","clock":"67:12"}}}`, string(b))
+}
+
+func TestDeliveryContentState(t *testing.T) {
+	state := contentstate.DeliveryContentState{Status: "on the way", EstimatedArrival: 718000000, StopsAway: 3}
+	payload := NewPayload().Event(EventUpdate).Timestamp(1).ContentState(state)
+	assert.NoError(t, payload.Validate())
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"timestamp":1,"event":"update","content-state":{"status":"on the way","estimatedArrival":718000000,"stopsAway":3}}}`, string(b))
+}
+
+func TestScoreUpdate(t *testing.T) {
+	payload := contentstate.ScoreUpdate(3, 2, "goal.caf")
+	assert.NoError(t, payload.Validate())
+	b, _ := payload.MarshalJSONAt(time.Unix(1000, 0))
+	assert.Equal(t, `{"aps":{"sound":"goal.caf","timestamp":1000,"event":"update","content-state":{"homeScore":3,"awayScore":2}}}`, string(b))
+}
+
+func TestScoreUpdateWithoutSound(t *testing.T) {
+	b, _ := json.Marshal(contentstate.ScoreUpdate(0, 0, ""))
+	assert.NotContains(t, string(b), "sound")
+	assert.Contains(t, string(b), `"content-state":{"homeScore":0,"awayScore":0}`)
+}
@@ -0,0 +1,30 @@
+package liveacvititypayload
+
+// Live Activity events, used as the value of the aps event key.
+const (
+	// EventStart starts a new Live Activity.
+	EventStart = "start"
+
+	// EventUpdate updates the content state of a running Live Activity.
+	EventUpdate = "update"
+
+	// EventEnd ends a running Live Activity.
+	EventEnd = "end"
+)
+
+// ValidTransition reports whether a Live Activity whose last event was from
+// may be sent the event to. Use "" as from for an activity that has not been
+// started yet. A Live Activity moves through start, any number of updates and
+// finally end; nothing may follow an end.
+//
+// This is an optional guardrail for servers that track activity state, and is
+// not enforced by the payload builder.
+func ValidTransition(from, to string) bool {
+	switch from {
+	case "":
+		return to == EventStart
+	case EventStart, EventUpdate:
+		return to == EventUpdate || to == EventEnd
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package liveacvititypayload_test
+
+import (
+	"testing"
+
+	. "github.com/mkc-bill/apns2/liveactivitypayload"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidTransition(t *testing.T) {
+	scenarios := []struct {
+		from, to string
+		valid    bool
+	}{
+		{"", EventStart, true},
+		{"", EventUpdate, false},
+		{"", EventEnd, false},
+		{EventStart, EventStart, false},
+		{EventStart, EventUpdate, true},
+		{EventStart, EventEnd, true},
+		{EventUpdate, EventStart, false},
+		{EventUpdate, EventUpdate, true},
+		{EventUpdate, EventEnd, true},
+		{EventEnd, EventStart, false},
+		{EventEnd, EventUpdate, false},
+		{EventEnd, EventEnd, false},
+		{EventStart, "bogus", false},
+		{"bogus", EventUpdate, false},
+	}
+	for _, s := range scenarios {
+		assert.Equal(t, s.valid, ValidTransition(s.from, s.to), "%q -> %q", s.from, s.to)
+	}
+}
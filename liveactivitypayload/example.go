@@ -0,0 +1,17 @@
+package liveacvititypayload
+
+import "time"
+
+// ExampleStartPayload returns a minimal payload which starts a Live Activity
+// of the given attributes type, timestamped now, with empty attributes and
+// content-state. It is intended for smoke tests and QA, where a known good
+// start event is needed.
+//
+//	{"aps":{"timestamp":now,"event":"start","content-state":{},"attributes-type":attributesType,"attributes":{}}}
+func ExampleStartPayload(attributesType string) *Payload {
+	return NewPayload().
+		Event(EventStart).
+		Timestamp(time.Now().Unix()).
+		Attributes(attributesType, nil).
+		ContentState(map[string]interface{}{})
+}
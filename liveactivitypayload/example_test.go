@@ -0,0 +1,32 @@
+package liveacvititypayload_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/mkc-bill/apns2/liveactivitypayload"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExampleStartPayload(t *testing.T) {
+	payload := ExampleStartPayload("DeliveryAttributes")
+	assert.NoError(t, payload.Validate())
+
+	b, _ := json.Marshal(payload)
+	var decoded struct {
+		Aps struct {
+			Timestamp      int64                  `json:"timestamp"`
+			Event          string                 `json:"event"`
+			AttributesType string                 `json:"attributes-type"`
+			Attributes     map[string]interface{} `json:"attributes"`
+			ContentState   map[string]interface{} `json:"content-state"`
+		} `json:"aps"`
+	}
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, EventStart, decoded.Aps.Event)
+	assert.Equal(t, "DeliveryAttributes", decoded.Aps.AttributesType)
+	assert.NotNil(t, decoded.Aps.Attributes)
+	assert.NotNil(t, decoded.Aps.ContentState)
+	assert.InDelta(t, time.Now().Unix(), decoded.Aps.Timestamp, 2)
+}
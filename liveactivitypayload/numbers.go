@@ -0,0 +1,71 @@
+package liveacvititypayload
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WholeNumbersAsInts makes the payload encode every number in the
+// content-state which has a whole value, such as 1.0 or 1e3, as an integer,
+// for an app which decodes the field as an Int and rejects a fraction. This
+// matters for numbers written with a fraction in JSON set with
+// ContentStateJSON, or held as json.Number after a round trip through
+// Snapshot. Numbers beyond the integers a float64 holds exactly are left as
+// written, as is everything else in the content-state.
+func (p *Payload) WholeNumbersAsInts() *Payload {
+	p.wholeNumbers = true
+	return p
+}
+
+// withWholeNumbers returns the content-state encoded with each whole number
+// written as an integer, or state itself if it cannot be encoded, leaving
+// marshalling to report the error.
+func withWholeNumbers(state interface{}, escapeHTML bool) interface{} {
+	b, err := encode(state, escapeHTML)
+	if err != nil {
+		return state
+	}
+	out := make([]byte, 0, len(b))
+	inString, escaped := false, false
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case inString:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '-' || c >= '0' && c <= '9':
+			j := i
+			for j < len(b) && strings.IndexByte("+-.0123456789eE", b[j]) >= 0 {
+				j++
+			}
+			out = append(out, wholeNumber(string(b[i:j]))...)
+			i = j
+			continue
+		}
+		out = append(out, c)
+		i++
+	}
+	return json.RawMessage(out)
+}
+
+// wholeNumber returns the JSON number s as an integer if it has a whole
+// value which a float64 holds exactly, and s unchanged otherwise.
+func wholeNumber(s string) string {
+	if !strings.ContainsAny(s, ".eE") {
+		return s
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+		return s
+	}
+	return strconv.FormatInt(int64(f), 10)
+}
@@ -0,0 +1,29 @@
+package liveacvititypayload_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/mkc-bill/apns2/liveactivitypayload"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWholeNumbersAsInts(t *testing.T) {
+	state := `{"score":1.0,"away":-2.00,"big":1e3,"ratio":0.5,"id":12345678901234567890.0,"label":"1.0","note":"a \"2.0\" b","laps":[3.0,4]}`
+	payload := NewPayload().Event(EventUpdate).ContentStateJSON([]byte(state)).WholeNumbersAsInts()
+	b, err := payload.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"aps":{"event":"update","content-state":{"score":1,"away":-2,"big":1000,"ratio":0.5,"id":12345678901234567890.0,"label":"1.0","note":"a \"2.0\" b","laps":[3,4]}}}`, string(b))
+}
+
+func TestWholeNumbersAsIntsJSONNumber(t *testing.T) {
+	payload := NewPayload().Event(EventUpdate).ContentState(map[string]interface{}{"score": json.Number("2.0")}).WholeNumbersAsInts()
+	b, _ := payload.MarshalJSON()
+	assert.Equal(t, `{"aps":{"event":"update","content-state":{"score":2}}}`, string(b))
+}
+
+func TestWholeNumbersOptIn(t *testing.T) {
+	payload := NewPayload().Event(EventUpdate).ContentStateJSON([]byte(`{"score":1.0}`))
+	b, _ := payload.MarshalJSON()
+	assert.Equal(t, `{"aps":{"event":"update","content-state":{"score":1.0}}}`, string(b))
+}
@@ -0,0 +1,57 @@
+package liveacvititypayload
+
+import (
+	"reflect"
+	"strings"
+)
+
+// DescribeContentState returns the JSON keys a content-state value marshals
+// to, mapped to the Go type of each field, such as "int", "string" or
+// "[]string". It follows encoding/json rules for field names, so fields
+// tagged "-" and unexported fields are left out and the fields of embedded
+// structs are promoted. The description can be diffed against the Swift
+// ContentState of the app to keep the two in sync.
+//
+// v must be a struct or a pointer to one; otherwise nil is returned.
+func DescribeContentState(v interface{}) map[string]string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	schema := map[string]string{}
+	describeFields(t, schema)
+	return schema
+}
+
+func describeFields(t reflect.Type, schema map[string]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				describeFields(ft, schema)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := schema[name]; !ok {
+			schema[name] = field.Type.String()
+		}
+	}
+}
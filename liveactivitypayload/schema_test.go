@@ -0,0 +1,40 @@
+package liveacvititypayload_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/mkc-bill/apns2/liveactivitypayload"
+	"github.com/stretchr/testify/assert"
+)
+
+type Progress struct {
+	Percent float64 `json:"percent"`
+}
+
+type DeliveryState struct {
+	Progress
+	Status   string    `json:"status"`
+	ETA      time.Time `json:"eta,omitempty"`
+	Stops    []string  `json:"stops"`
+	Driver   *string
+	Internal string `json:"-"`
+	secret   string
+}
+
+func TestDescribeContentState(t *testing.T) {
+	expected := map[string]string{
+		"percent": "float64",
+		"status":  "string",
+		"eta":     "time.Time",
+		"stops":   "[]string",
+		"Driver":  "*string",
+	}
+	assert.Equal(t, expected, DescribeContentState(DeliveryState{}))
+	assert.Equal(t, expected, DescribeContentState(&DeliveryState{}))
+}
+
+func TestDescribeContentStateNotStruct(t *testing.T) {
+	assert.Nil(t, DescribeContentState(map[string]int{"score": 1}))
+	assert.Nil(t, DescribeContentState(nil))
+}
@@ -0,0 +1,164 @@
+package liveacvititypayload
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// UnixTimes makes the payload encode every time.Time in the content-state,
+// including those in nested structs, maps and slices, as the number of
+// seconds since the Unix epoch rather than as an RFC 3339 string, to match an
+// app which decodes dates with the secondsSince1970 strategy. Values which
+// marshal themselves, other than time.Time, are left alone.
+func (p *Payload) UnixTimes() *Payload {
+	p.unixTimes = true
+	return p
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// withUnixTimes returns v with each time.Time replaced by its Unix time,
+// encoding as v would otherwise. Structs become objects which keep their
+// field order, honouring the name, omitempty and "-" options of json tags.
+func withUnixTimes(v reflect.Value, escapeHTML bool) interface{} {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return withUnixTimes(v.Elem(), escapeHTML)
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Unix()
+	}
+	if v.Type().Implements(marshalerType) || reflect.PtrTo(v.Type()).Implements(marshalerType) {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = withUnixTimes(iter.Value(), escapeHTML)
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = withUnixTimes(v.Index(i), escapeHTML)
+		}
+		return s
+	case reflect.Struct:
+		o := &orderedObject{escapeHTML: escapeHTML}
+		o.addFields(v)
+		return o
+	}
+	return v.Interface()
+}
+
+// orderedObject is a JSON object whose keys are encoded in the order added.
+type orderedObject struct {
+	keys       []string
+	values     []interface{}
+	escapeHTML bool
+}
+
+// addFields adds the exported fields of the struct v as json.Marshal would,
+// with those of embedded structs without a json name promoted.
+func (o *orderedObject) addFields(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, opts = tag[:comma], tag[comma:]
+		}
+		value := v.Field(i)
+		if field.Anonymous && name == "" {
+			embedded := value
+			if embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				o.addFields(embedded)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if strings.Contains(opts, ",omitempty") && isEmptyValue(value) {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		o.keys = append(o.keys, name)
+		o.values = append(o.values, withUnixTimes(value, o.escapeHTML))
+	}
+}
+
+// MarshalJSON encodes the object with its keys in order.
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := encode(key, o.escapeHTML)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		value, err := encode(o.values[i], o.escapeHTML)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// isEmptyValue reports whether v is empty in the sense of the omitempty
+// option of json tags.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
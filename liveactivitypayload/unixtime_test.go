@@ -0,0 +1,70 @@
+package liveacvititypayload_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/mkc-bill/apns2/liveactivitypayload"
+	"github.com/stretchr/testify/assert"
+)
+
+type deliveryState struct {
+	Status   string     `json:"status"`
+	ETA      time.Time  `json:"eta"`
+	Pickup   *time.Time `json:"pickup,omitempty"`
+	Note     string     `json:"note,omitempty"`
+	Internal string     `json:"-"`
+	Stops    []stop     `json:"stops"`
+}
+
+type stop struct {
+	Name    string
+	Arrival time.Time `json:"arrival"`
+}
+
+func TestUnixTimes(t *testing.T) {
+	eta := time.Unix(1700000000, 0)
+	state := deliveryState{
+		Status:   "Tom & Jerry's",
+		ETA:      eta,
+		Internal: "secret",
+		Stops:    []stop{{Name: "depot", Arrival: eta.Add(-time.Hour)}},
+	}
+	payload := NewPayload().Event(EventUpdate).Timestamp(1).ContentState(state).UnixTimes()
+	b, err := payload.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"aps":{"timestamp":1,"event":"update","content-state":{"status":"Tom \u0026 Jerry's","eta":1700000000,"stops":[{"Name":"depot","arrival":1699996400}]}}}`, string(b))
+
+	payload.DisableHTMLEscape()
+	b, _ = payload.MarshalJSON()
+	assert.Contains(t, string(b), `"status":"Tom & Jerry's"`)
+}
+
+func TestUnixTimesMapAndPointer(t *testing.T) {
+	pickup := time.Unix(1700000000, 0)
+	payload := NewPayload().Event(EventUpdate).Timestamp(1).UnixTimes().
+		ContentState(map[string]interface{}{"pickup": &pickup, "state": deliveryState{Pickup: &pickup}})
+	b, err := payload.MarshalJSON()
+	assert.NoError(t, err)
+
+	var decoded struct {
+		Aps struct {
+			ContentState struct {
+				Pickup int64 `json:"pickup"`
+				State  struct {
+					Pickup int64 `json:"pickup"`
+				} `json:"state"`
+			} `json:"content-state"`
+		} `json:"aps"`
+	}
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, int64(1700000000), decoded.Aps.ContentState.Pickup)
+	assert.Equal(t, int64(1700000000), decoded.Aps.ContentState.State.Pickup)
+}
+
+func TestUnixTimesOptIn(t *testing.T) {
+	eta := time.Unix(1700000000, 0).UTC()
+	b, _ := NewPayload().Event(EventUpdate).Timestamp(1).ContentState(map[string]time.Time{"eta": eta}).MarshalJSON()
+	assert.Contains(t, string(b), `"eta":"2023-11-14T22:13:20Z"`)
+}
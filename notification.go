@@ -1,8 +1,16 @@
 package apns2
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/mkc-bill/apns2/token"
 )
 
 // EPushType defines the value for the apns-push-type header
@@ -32,7 +40,9 @@ const (
 	// tvOS, and watchOS. If the location query requires an immediate response
 	// from the Location Push Service Extension, set notification apns-priority
 	// to 10; otherwise, use 5. The location push type supports only token-based
-	// authentication.
+	// authentication. When pushed through a Client, a location notification
+	// without a Priority is sent with PriorityHigh, and one without a Topic
+	// uses the Client's default topic with LocationTopicSuffix appended.
 	PushTypeLocation EPushType = "location"
 
 	// PushTypeVOIP is used for notifications that provide information about an
@@ -68,6 +78,18 @@ const (
 	LiveActivity EPushType = "liveactivity"
 )
 
+// The message storage policies of a broadcast channel, sent as the
+// apns-message-storage-policy header of broadcast notifications.
+const (
+	// StoragePolicyNone does not store broadcast messages, so devices which
+	// subscribe to the channel later wait for the next broadcast.
+	StoragePolicyNone = 0
+
+	// StoragePolicyMostRecent stores the most recent broadcast message, which
+	// is delivered to devices when they subscribe to the channel.
+	StoragePolicyMostRecent = 1
+)
+
 const (
 	// PriorityLow will tell APNs to send the push message at a time that takes
 	// into account power considerations for the device. Notifications with this
@@ -82,6 +104,44 @@ const (
 	PriorityHigh = 10
 )
 
+// LiveActivityTopicSuffix is appended to an app's bundle ID to form the
+// apns-topic for Live Activity notifications.
+const LiveActivityTopicSuffix = ".push-type.liveactivity"
+
+// LocationTopicSuffix is appended to an app's bundle ID to form the
+// apns-topic for location notifications.
+const LocationTopicSuffix = ".location-query"
+
+// Possible errors when validating a Notification.
+var (
+	ErrInvalidBundleID           = errors.New("apns2: invalid bundle ID")
+	ErrAlertRequiresHighPriority = errors.New("apns2: a Live Activity notification with an alert must use priority 10")
+	ErrInvalidPayload            = errors.New("apns2: payload is not valid JSON")
+	ErrInvalidTopic              = errors.New("apns2: topic must be a bundle ID of at most 255 characters")
+	ErrPushTypeTopicMismatch     = errors.New("apns2: liveactivity push type must be used with a topic ending in " + LiveActivityTopicSuffix)
+	ErrLocationHasAlert          = errors.New("apns2: a location notification must not have an alert")
+	ErrDuplicateCollapseID       = errors.New("apns2: an earlier notification to the same recipient has the same collapse ID")
+	ErrNotLiveActivity           = errors.New("apns2: push type must be liveactivity")
+	ErrNotLiveActivityUpdate     = errors.New("apns2: payload must be a Live Activity update event")
+	ErrInvalidPriority           = errors.New("apns2: priority must be 5 or 10")
+)
+
+// LiveActivityTopic returns the apns-topic to use for Live Activity
+// notifications sent to the app with the given bundle ID. A bundle ID which
+// already carries the Live Activity suffix is returned unchanged.
+func LiveActivityTopic(bundleID string) (string, error) {
+	if bundleID == "" || strings.ContainsAny(bundleID, " \t\r\n") {
+		return "", ErrInvalidBundleID
+	}
+	if strings.HasSuffix(bundleID, LiveActivityTopicSuffix) {
+		if bundleID == LiveActivityTopicSuffix {
+			return "", ErrInvalidBundleID
+		}
+		return bundleID, nil
+	}
+	return bundleID + LiveActivityTopicSuffix, nil
+}
+
 // Notification represents the the data and metadata for a APNs Remote Notification.
 type Notification struct {
 
@@ -130,12 +190,238 @@ type Notification struct {
 	// A byte array containing the JSON-encoded payload of this push notification.
 	// Refer to "The Remote Notification Payload" section in the Apple Local and
 	// Remote Notification Programming Guide for more info.
+	//
+	// A string, []byte or json.RawMessage payload is sent verbatim, without
+	// being re-marshalled, after checking that it is valid JSON. Any other
+	// value is marshalled with encoding/json.
 	Payload interface{}
 
 	// The pushtype of the push notification. If this values is left as the
 	// default an apns-push-type header with value 'alert' will be added to the
 	// http request.
 	PushType EPushType
+
+	// The broadcast channel to send the notification to. If set, the
+	// notification is broadcast to every device subscribed to the channel
+	// instead of being sent to DeviceToken, to the app whose bundle ID is the
+	// Topic without LiveActivityTopicSuffix.
+	ChannelID string
+
+	// The message storage policy of a broadcast notification, either
+	// StoragePolicyNone or StoragePolicyMostRecent. It is sent only when
+	// ChannelID is set.
+	StoragePolicy int
+
+	// An optional provider token used to authenticate this notification in
+	// place of the Client's Token, for services sending on behalf of several
+	// apps from one Client.
+	Token *token.Token
+
+	// An optional certificate used to authenticate this notification in place
+	// of the Client's credentials. The Client keeps a separate connection pool
+	// for each certificate, so reuse the same *tls.Certificate across
+	// notifications rather than loading it again for each push.
+	Certificate *tls.Certificate
+
+	expireAfter time.Duration
+}
+
+// ExpireAfter makes the notification expire d after it is pushed. The
+// expiration is computed each time the notification is sent rather than when
+// ExpireAfter is called, so a Notification can be built ahead of time and
+// reused. An explicit Expiration takes precedence.
+func (n *Notification) ExpireAfter(d time.Duration) *Notification {
+	n.expireAfter = d
+	return n
+}
+
+// Clone returns a copy of the notification which can be modified, for example
+// to set a different DeviceToken, without affecting n. A []byte or
+// json.RawMessage payload is copied too. Any other payload, such as one made
+// with a payload builder, is shared with n, as are the Token and Certificate,
+// so they must not be modified while either notification is being sent.
+func (n *Notification) Clone() *Notification {
+	m := *n
+	switch payload := n.Payload.(type) {
+	case []byte:
+		m.Payload = append([]byte(nil), payload...)
+	case json.RawMessage:
+		m.Payload = append(json.RawMessage(nil), payload...)
+	}
+	return &m
+}
+
+// Redacted returns a description of the notification safe to write to logs:
+// the headers it would be sent with and the size of its payload, with the
+// device token masked to its first and last four characters. The payload
+// content, which may hold personal data, and the credentials are never
+// included.
+func (n *Notification) Redacted() string {
+	request := &http.Request{Header: http.Header{}}
+	setHeaders(request, n, time.Now())
+	keys := make([]string, 0, len(request.Header))
+	for key := range request.Header {
+		keys = append(keys, strings.ToLower(key))
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("device-token=" + maskToken(n.DeviceToken))
+	for _, key := range keys {
+		b.WriteString(" " + key + "=" + request.Header.Get(key))
+	}
+	if payload, err := n.marshalPayload(time.Now()); err != nil {
+		fmt.Fprintf(&b, " payload=<invalid: %v>", err)
+	} else {
+		fmt.Fprintf(&b, " payload=<%d bytes>", len(payload))
+	}
+	return b.String()
+}
+
+// maskToken hides all but the first and last four characters of a device
+// token, or all of a token too short to keep any.
+func maskToken(token string) string {
+	if len(token) <= 8 {
+		return strings.Repeat("*", len(token))
+	}
+	return token[:4] + "..." + token[len(token)-4:]
+}
+
+// expiration returns the effective expiration of the notification if it were
+// sent at now, or the zero time if it has none.
+func (n *Notification) expiration(now time.Time) time.Time {
+	if !n.Expiration.IsZero() {
+		return n.Expiration
+	}
+	if n.expireAfter > 0 {
+		return now.Add(n.expireAfter)
+	}
+	return time.Time{}
+}
+
+// validator is implemented by payloads which can check their own content, such
+// as the payload and liveactivitypayload builders.
+type validator interface {
+	Validate() error
+}
+
+// alerter is implemented by payloads which can report whether they alert the
+// user.
+type alerter interface {
+	HasAlert() bool
+}
+
+// Validate checks the Notification for mistakes which would cause APNs to
+// reject it, without sending it. If the Payload has a Validate method, its
+// result is returned first. A Topic, if set, must look like a bundle ID. The
+// liveactivity push type and a topic ending in
+// LiveActivityTopicSuffix must be used together. A Live Activity notification
+// which alerts the user must be sent with PriorityHigh.
+func (n *Notification) Validate() error {
+	if v, ok := n.Payload.(validator); ok {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+	if n.Topic != "" {
+		if !validTopic(n.Topic) {
+			return ErrInvalidTopic
+		}
+		liveActivityTopic := strings.HasSuffix(n.Topic, LiveActivityTopicSuffix)
+		if liveActivityTopic != (n.PushType == LiveActivity) {
+			return ErrPushTypeTopicMismatch
+		}
+	}
+	if n.PushType == LiveActivity {
+		if a, ok := n.Payload.(alerter); ok && a.HasAlert() && n.Priority != 0 && n.Priority != PriorityHigh {
+			return ErrAlertRequiresHighPriority
+		}
+	}
+	if n.PushType == PushTypeLocation {
+		if a, ok := n.Payload.(alerter); ok && a.HasAlert() {
+			return ErrLocationHasAlert
+		}
+	}
+	return nil
+}
+
+// MaxTopicLength is the longest apns-topic accepted by Validate.
+const MaxTopicLength = 255
+
+// validTopic reports whether topic looks like a bundle ID, optionally with a
+// push type suffix: dot separated components of letters, digits, hyphens and
+// underscores, none of them empty.
+func validTopic(topic string) bool {
+	if len(topic) > MaxTopicLength {
+		return false
+	}
+	for _, component := range strings.Split(topic, ".") {
+		if component == "" {
+			return false
+		}
+		for _, c := range component {
+			if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ValidateAll validates each of the notifications, returning their errors in
+// the same order, so that problems across a large list can be fixed in bulk
+// before sending. The error for a valid notification is nil. It returns nil
+// if every notification is valid.
+//
+// A notification which shares its CollapseID, Topic and device token or
+// channel with an earlier one in the list is reported as
+// ErrDuplicateCollapseID, as the device would only show whichever of the two
+// arrives last.
+func ValidateAll(notifications []*Notification) []error {
+	var errs []error
+	duplicates := duplicateCollapseIDs(notifications)
+	for i, n := range notifications {
+		err := n.Validate()
+		if err == nil && duplicates[i] >= 0 {
+			err = ErrDuplicateCollapseID
+		}
+		if err != nil {
+			if errs == nil {
+				errs = make([]error, len(notifications))
+			}
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+// eventer is implemented by payloads which report their Live Activity event,
+// such as those of the liveactivitypayload builder.
+type eventer interface {
+	CurrentEvent() string
+}
+
+// ValidateLiveActivityUpdate checks all the rules for a Live Activity update
+// notification in one call. The PushType must be LiveActivity, the Topic, if
+// set, must end in LiveActivityTopicSuffix, and the Priority, if set, must be
+// PriorityLow or PriorityHigh. The payload must be a Live Activity payload
+// with the update event, and must pass its own Validate, which requires a
+// content-state and a timestamp. Each rule has its own error, such as
+// ErrNotLiveActivity or the liveactivitypayload ErrContentStateRequired.
+func ValidateLiveActivityUpdate(n *Notification) error {
+	if n.PushType != LiveActivity {
+		return ErrNotLiveActivity
+	}
+	if n.Topic != "" && !strings.HasSuffix(n.Topic, LiveActivityTopicSuffix) {
+		return ErrPushTypeTopicMismatch
+	}
+	if n.Priority != 0 && n.Priority != PriorityLow && n.Priority != PriorityHigh {
+		return ErrInvalidPriority
+	}
+	if e, ok := n.Payload.(eventer); !ok || e.CurrentEvent() != "update" {
+		return ErrNotLiveActivityUpdate
+	}
+	return n.Validate()
 }
 
 // MarshalJSON converts the notification payload to JSON.
@@ -145,7 +431,38 @@ func (n *Notification) MarshalJSON() ([]byte, error) {
 		return []byte(payload), nil
 	case []byte:
 		return payload, nil
+	case json.RawMessage:
+		return payload, nil
+	case json.Marshaler:
+		return payload.MarshalJSON()
 	default:
 		return json.Marshal(payload)
 	}
 }
+
+// timestamper is implemented by payloads, such as the Live Activity payload
+// builder, whose timestamp may be resolved at the time they are sent.
+type timestamper interface {
+	MarshalJSONAt(now time.Time) ([]byte, error)
+}
+
+// marshalPayload returns the payload exactly as it will be sent to APNs, with
+// now used for any timestamp resolved at send time. The result of MarshalJSON
+// is used verbatim rather than being re-encoded, which would escape HTML
+// characters the payload may have deliberately left alone.
+func (n *Notification) marshalPayload(now time.Time) ([]byte, error) {
+	var payload []byte
+	var err error
+	if t, ok := n.Payload.(timestamper); ok {
+		payload, err = t.MarshalJSONAt(now)
+	} else {
+		payload, err = n.MarshalJSON()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(payload) {
+		return nil, ErrInvalidPayload
+	}
+	return payload, nil
+}
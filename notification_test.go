@@ -1,9 +1,14 @@
 package apns2_test
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mkc-bill/apns2"
+	liveactivity "github.com/mkc-bill/apns2/liveactivitypayload"
+	"github.com/mkc-bill/apns2/payload"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,6 +20,7 @@ func TestMarshalJSON(t *testing.T) {
 	}{
 		{`{"a": "b"}`, []byte(`{"a": "b"}`), nil},
 		{[]byte(`{"a": "b"}`), []byte(`{"a": "b"}`), nil},
+		{json.RawMessage(`{"a": "b"}`), []byte(`{"a": "b"}`), nil},
 		{struct {
 			A string `json:"a"`
 		}{"b"}, []byte(`{"a":"b"}`), nil},
@@ -30,3 +36,217 @@ func TestMarshalJSON(t *testing.T) {
 		assert.Equal(t, scenario.err, err)
 	}
 }
+
+func TestLiveActivityTopic(t *testing.T) {
+	topic, err := apns2.LiveActivityTopic("com.example.app")
+	assert.NoError(t, err)
+	assert.Equal(t, "com.example.app.push-type.liveactivity", topic)
+}
+
+func TestLiveActivityTopicAlreadySuffixed(t *testing.T) {
+	topic, err := apns2.LiveActivityTopic("com.x.push-type.liveactivity")
+	assert.NoError(t, err)
+	assert.Equal(t, "com.x.push-type.liveactivity", topic)
+}
+
+func TestLiveActivityTopicInvalid(t *testing.T) {
+	for _, bundleID := range []string{"", "com.example app", ".push-type.liveactivity"} {
+		topic, err := apns2.LiveActivityTopic(bundleID)
+		assert.Equal(t, apns2.ErrInvalidBundleID, err)
+		assert.Equal(t, "", topic)
+	}
+}
+
+func TestValidateLiveActivityUpdateWithAlert(t *testing.T) {
+	n := &apns2.Notification{
+		PushType: apns2.LiveActivity,
+		Priority: apns2.PriorityHigh,
+		Payload: liveactivity.NewPayload().
+			Event(liveactivity.EventUpdate).
+			Timestamp(1680000000).
+			ContentState(map[string]interface{}{"score": 2}).
+			Alert(map[string]interface{}{"title": "Goal!", "sound": "default"}),
+	}
+	assert.NoError(t, n.Validate())
+
+	n.Priority = apns2.PriorityLow
+	assert.Equal(t, apns2.ErrAlertRequiresHighPriority, n.Validate())
+}
+
+func TestValidatePayloadError(t *testing.T) {
+	n := &apns2.Notification{
+		PushType: apns2.LiveActivity,
+		Payload:  liveactivity.NewPayload().Event(liveactivity.EventUpdate).Timestamp(1),
+	}
+	assert.Equal(t, liveactivity.ErrContentStateRequired, n.Validate())
+}
+
+func TestValidatePushTypeTopicMismatch(t *testing.T) {
+	n := &apns2.Notification{
+		Topic:    "com.example.app.push-type.liveactivity",
+		PushType: apns2.PushTypeAlert,
+		Payload:  []byte(`{"aps":{}}`),
+	}
+	assert.Equal(t, apns2.ErrPushTypeTopicMismatch, n.Validate())
+
+	n.PushType = ""
+	assert.Equal(t, apns2.ErrPushTypeTopicMismatch, n.Validate())
+
+	n.Topic = "com.example.app"
+	n.PushType = apns2.LiveActivity
+	assert.Equal(t, apns2.ErrPushTypeTopicMismatch, n.Validate())
+
+	n.Topic = "com.example.app.push-type.liveactivity"
+	assert.NoError(t, n.Validate())
+}
+
+func TestValidateAll(t *testing.T) {
+	valid := &apns2.Notification{Topic: "com.example.app", Payload: []byte(`{"aps":{}}`)}
+	mismatch := &apns2.Notification{
+		Topic:    "com.example.app",
+		PushType: apns2.LiveActivity,
+		Payload:  []byte(`{"aps":{}}`),
+	}
+	badPayload := &apns2.Notification{
+		PushType: apns2.LiveActivity,
+		Payload:  liveactivity.NewPayload().Event(liveactivity.EventUpdate).Timestamp(1),
+	}
+
+	errs := apns2.ValidateAll([]*apns2.Notification{valid, mismatch, valid, badPayload})
+	assert.Equal(t, []error{nil, apns2.ErrPushTypeTopicMismatch, nil, liveactivity.ErrContentStateRequired}, errs)
+	assert.Nil(t, apns2.ValidateAll([]*apns2.Notification{valid, valid}))
+}
+
+func TestValidateAllDuplicateCollapseID(t *testing.T) {
+	first := &apns2.Notification{DeviceToken: "aa", Topic: "com.example.app", CollapseID: "score", Payload: []byte(`{"aps":{}}`)}
+	second := &apns2.Notification{DeviceToken: "aa", Topic: "com.example.app", CollapseID: "score", Payload: []byte(`{"aps":{}}`)}
+	otherToken := &apns2.Notification{DeviceToken: "bb", Topic: "com.example.app", CollapseID: "score", Payload: []byte(`{"aps":{}}`)}
+	otherID := &apns2.Notification{DeviceToken: "aa", Topic: "com.example.app", CollapseID: "news", Payload: []byte(`{"aps":{}}`)}
+
+	errs := apns2.ValidateAll([]*apns2.Notification{first, otherToken, otherID, second})
+	assert.Equal(t, []error{nil, nil, nil, apns2.ErrDuplicateCollapseID}, errs)
+	assert.Nil(t, apns2.ValidateAll([]*apns2.Notification{first, otherToken, otherID}))
+}
+
+func TestValidateLocation(t *testing.T) {
+	n := &apns2.Notification{
+		Topic:    "com.example.app" + apns2.LocationTopicSuffix,
+		PushType: apns2.PushTypeLocation,
+		Payload:  payload.NewPayload(),
+	}
+	assert.NoError(t, n.Validate())
+	n.Payload = payload.NewPayload().Alert("Where are you?")
+	assert.Equal(t, apns2.ErrLocationHasAlert, n.Validate())
+}
+
+func TestClone(t *testing.T) {
+	n := &apns2.Notification{
+		DeviceToken: "aa",
+		Topic:       "com.example.app",
+		Priority:    apns2.PriorityHigh,
+		Payload:     []byte(`{"aps":{}}`),
+	}
+	n.ExpireAfter(time.Minute)
+	clone := n.Clone()
+	assert.Equal(t, n, clone)
+
+	clone.DeviceToken = "bb"
+	clone.Payload.([]byte)[2] = 'x'
+	assert.Equal(t, "aa", n.DeviceToken)
+	assert.Equal(t, `{"aps":{}}`, string(n.Payload.([]byte)))
+
+	raw := &apns2.Notification{Payload: json.RawMessage(`{"aps":{}}`)}
+	rawClone := raw.Clone()
+	rawClone.Payload.(json.RawMessage)[2] = 'x'
+	assert.Equal(t, `{"aps":{}}`, string(raw.Payload.(json.RawMessage)))
+}
+
+func TestValidateLiveActivityUpdate(t *testing.T) {
+	update := func() *apns2.Notification {
+		return &apns2.Notification{
+			Topic:    "com.example.app" + apns2.LiveActivityTopicSuffix,
+			PushType: apns2.LiveActivity,
+			Priority: apns2.PriorityLow,
+			Payload:  liveactivity.NewPayload().Event(liveactivity.EventUpdate).Timestamp(1).ContentState(map[string]int{"score": 1}),
+		}
+	}
+	assert.NoError(t, apns2.ValidateLiveActivityUpdate(update()))
+
+	n := update()
+	n.PushType = apns2.PushTypeAlert
+	assert.Equal(t, apns2.ErrNotLiveActivity, apns2.ValidateLiveActivityUpdate(n))
+
+	n = update()
+	n.Topic = "com.example.app"
+	assert.Equal(t, apns2.ErrPushTypeTopicMismatch, apns2.ValidateLiveActivityUpdate(n))
+
+	n = update()
+	n.Priority = 1
+	assert.Equal(t, apns2.ErrInvalidPriority, apns2.ValidateLiveActivityUpdate(n))
+
+	n = update()
+	n.Payload = liveactivity.NewPayload().End().Timestamp(1)
+	assert.Equal(t, apns2.ErrNotLiveActivityUpdate, apns2.ValidateLiveActivityUpdate(n))
+
+	n = update()
+	n.Payload = []byte(`{"aps":{"event":"update"}}`)
+	assert.Equal(t, apns2.ErrNotLiveActivityUpdate, apns2.ValidateLiveActivityUpdate(n))
+
+	n = update()
+	n.Payload = liveactivity.NewPayload().Event(liveactivity.EventUpdate).Timestamp(1)
+	assert.Equal(t, liveactivity.ErrContentStateRequired, apns2.ValidateLiveActivityUpdate(n))
+
+	n = update()
+	n.Payload = liveactivity.NewPayload().Event(liveactivity.EventUpdate).ContentState(map[string]int{"score": 1})
+	assert.Equal(t, liveactivity.ErrTimestampRequired, apns2.ValidateLiveActivityUpdate(n))
+
+	n = update()
+	n.Payload = liveactivity.NewPayload().Event(liveactivity.EventUpdate).Timestamp(1).ContentState(map[string]int{"score": 1}).Alert("Goal!")
+	assert.Equal(t, apns2.ErrAlertRequiresHighPriority, apns2.ValidateLiveActivityUpdate(n))
+}
+
+func TestValidateTopic(t *testing.T) {
+	for _, topic := range []string{
+		"com example app",
+		"com.example.",
+		".com.example",
+		"com..example",
+		"com.example/app",
+		"com.exämple.app",
+		"com." + strings.Repeat("a", 252),
+	} {
+		n := &apns2.Notification{Topic: topic, Payload: []byte(`{"aps":{}}`)}
+		assert.Equal(t, apns2.ErrInvalidTopic, n.Validate(), topic)
+	}
+	for _, topic := range []string{
+		"com.example.app",
+		"com.example.my-app.voip",
+		"com.example.app.push-type.liveactivity",
+		"com.apple.mgmt.External.1d1d7e2c-4f8f-4e2a-a7d9-2b9b0c0e6f3a",
+	} {
+		n := &apns2.Notification{Topic: topic, Payload: []byte(`{"aps":{}}`)}
+		if topic == "com.example.app.push-type.liveactivity" {
+			n.PushType = apns2.LiveActivity
+		}
+		assert.NoError(t, n.Validate(), topic)
+	}
+}
+
+func TestNotificationRedacted(t *testing.T) {
+	n := mockNotification()
+	n.Topic = "com.testapp"
+	n.Priority = apns2.PriorityHigh
+	n.Token = mockToken()
+	n.Token.Generate()
+	s := n.Redacted()
+	assert.Equal(t, "device-token=11aa...9ef7 apns-priority=10 apns-push-type=alert apns-topic=com.testapp content-type=application/json; charset=utf-8 payload=<26 bytes>", s)
+	assert.NotContains(t, s, n.DeviceToken)
+	assert.NotContains(t, s, "Hello!")
+	assert.NotContains(t, strings.ToLower(s), "authorization")
+	assert.NotContains(t, s, n.Token.Bearer)
+}
+
+func TestNotificationRedactedShortToken(t *testing.T) {
+	n := &apns2.Notification{DeviceToken: "abc", Payload: []byte(`{`)}
+	assert.Equal(t, "device-token=*** apns-push-type=alert content-type=application/json; charset=utf-8 payload=<invalid: apns2: payload is not valid JSON>", n.Redacted())
+}
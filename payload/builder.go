@@ -2,7 +2,21 @@
 // builder to make constructing notification payloads easier.
 package payload
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrInvalidUTF8 is returned by Validate when alert text contains bytes that
+// are not valid UTF-8.
+var ErrInvalidUTF8 = errors.New("payload: alert text is not valid UTF-8")
+
+// ErrInvalidInterruptionLevel is returned by ParseInterruptionLevel for a
+// name which is not an interruption level.
+var ErrInvalidInterruptionLevel = errors.New("payload: unknown interruption level")
 
 // InterruptionLevel defines the value for the payload aps interruption-level
 type EInterruptionLevel string
@@ -23,10 +37,32 @@ const (
 	InterruptionLevelCritical EInterruptionLevel = "critical"
 )
 
+// ParseInterruptionLevel returns the interruption level named s, one of
+// "passive", "active", "time-sensitive" or "critical", for example when it
+// is read from configuration. Any other value, including differently cased
+// names, returns ErrInvalidInterruptionLevel.
+func ParseInterruptionLevel(s string) (EInterruptionLevel, error) {
+	l := EInterruptionLevel(s)
+	if !l.IsValid() {
+		return "", fmt.Errorf("%w: %q", ErrInvalidInterruptionLevel, s)
+	}
+	return l, nil
+}
+
+// IsValid reports whether l is one of the interruption levels APNs accepts.
+func (l EInterruptionLevel) IsValid() bool {
+	switch l {
+	case InterruptionLevelPassive, InterruptionLevelActive, InterruptionLevelTimeSensitive, InterruptionLevelCritical:
+		return true
+	}
+	return false
+}
+
 // Payload represents a notification which holds the content that will be
 // marshalled as JSON.
 type Payload struct {
-	content map[string]interface{}
+	content      map[string]interface{}
+	noEscapeHTML bool
 }
 
 type aps struct {
@@ -38,6 +74,7 @@ type aps struct {
 	MutableContent    int                `json:"mutable-content,omitempty"`
 	RelevanceScore    interface{}        `json:"relevance-score,omitempty"`
 	Sound             interface{}        `json:"sound,omitempty"`
+	TargetContentID   string             `json:"target-content-id,omitempty"`
 	ThreadID          string             `json:"thread-id,omitempty"`
 	URLArgs           []string           `json:"url-args,omitempty"`
 }
@@ -66,7 +103,7 @@ type sound struct {
 // NewPayload returns a new Payload struct
 func NewPayload() *Payload {
 	return &Payload{
-		map[string]interface{}{
+		content: map[string]interface{}{
 			"aps": &aps{},
 		},
 	}
@@ -205,7 +242,8 @@ func (p *Payload) AlertBody(body string) *Payload {
 // AlertLaunchImage sets the aps launch image on the payload.
 // This is the filename of an image file in the app bundle. The image is used
 // as the launch image when users tap the action button or move the action
-// slider.
+// slider. The launch-image key only exists in the dictionary form of the
+// alert, so a string alert set with Alert becomes the alert body.
 //
 //	{"aps":{"alert":{"launch-image":image}}}
 func (p *Payload) AlertLaunchImage(image string) *Payload {
@@ -301,6 +339,16 @@ func (p *Payload) Mdm(mdm string) *Payload {
 	return p
 }
 
+// TargetContentID sets the aps target-content-id on the payload.
+// This is the identifier of the window brought forward when the user opens
+// the notification, for apps that support multiple windows or scenes.
+//
+//	{"aps":{"target-content-id":id}}
+func (p *Payload) TargetContentID(id string) *Payload {
+	p.aps().TargetContentID = id
+	return p
+}
+
 // ThreadID sets the aps thread id on the payload.
 // This is for the purpose of updating the contents of a View Controller in a
 // Notification Content app extension when a new notification arrives. If a
@@ -314,7 +362,7 @@ func (p *Payload) ThreadID(threadID string) *Payload {
 	return p
 }
 
-// URLArgs sets the aps category on the payload.
+// URLArgs sets the aps url-args on the payload.
 // This specifies an array of values that are paired with the placeholders
 // inside the urlFormatString value of your website.json file.
 // See Apple Notification Programming Guide for Websites.
@@ -378,17 +426,90 @@ func (p *Payload) UnsetRelevanceScore() *Payload {
 	return p
 }
 
+// Validate checks the payload for content that APNs will reject. It reports
+// alert title, subtitle and body strings which are not valid UTF-8, which
+// usually indicates mojibake from an upstream data source.
+func (p *Payload) Validate() error {
+	switch a := p.aps().Alert.(type) {
+	case string:
+		if !utf8.ValidString(a) {
+			return fmt.Errorf("%w: alert", ErrInvalidUTF8)
+		}
+	case *alert:
+		fields := []struct {
+			name  string
+			value string
+		}{
+			{"title", a.Title},
+			{"subtitle", a.Subtitle},
+			{"body", a.Body},
+		}
+		for _, f := range fields {
+			if !utf8.ValidString(f.value) {
+				return fmt.Errorf("%w: alert %s", ErrInvalidUTF8, f.name)
+			}
+		}
+	}
+	return nil
+}
+
+// DisableHTMLEscape stops the characters <, > and & from being escaped as
+// \u003c, \u003e and \u0026 when the payload is marshalled, so alert text
+// containing URLs or symbols is sent as written. By default they are escaped,
+// as with json.Marshal.
+func (p *Payload) DisableHTMLEscape() *Payload {
+	p.noEscapeHTML = true
+	return p
+}
+
+// HasAlert reports whether an alert has been set on the payload.
+func (p *Payload) HasAlert() bool {
+	return p.aps().Alert != nil
+}
+
+// Reset clears the payload back to the state returned by NewPayload so that
+// it can be reused to build another notification, keeping the map which
+// holds its content allocated. The payload must not be reset while a
+// notification it belongs to is still being sent.
+//
+//	{"aps":{}}
+func (p *Payload) Reset() *Payload {
+	for key := range p.content {
+		if key != "aps" {
+			delete(p.content, key)
+		}
+	}
+	*p.aps() = aps{}
+	p.noEscapeHTML = false
+	return p
+}
+
 // MarshalJSON returns the JSON encoded version of the Payload
 func (p *Payload) MarshalJSON() ([]byte, error) {
-	return json.Marshal(p.content)
+	if !p.noEscapeHTML {
+		return json.Marshal(p.content)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(p.content); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
 }
 
 func (p *Payload) aps() *aps {
 	return p.content["aps"].(*aps)
 }
 
+// alert returns the dictionary form of the alert, converting a string alert
+// set with Alert into the dictionary's body so that it isn't lost.
 func (a *aps) alert() *alert {
-	if _, ok := a.Alert.(*alert); !ok {
+	switch current := a.Alert.(type) {
+	case *alert:
+	case string:
+		a.Alert = &alert{Body: current}
+	default:
 		a.Alert = &alert{}
 	}
 	return a.Alert.(*alert)
@@ -2,6 +2,7 @@ package payload_test
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
 
 	. "github.com/mkc-bill/apns2/payload"
@@ -122,6 +123,12 @@ func TestAlertLaunchImage(t *testing.T) {
 	assert.Equal(t, `{"aps":{"alert":{"launch-image":"Default.png"}}}`, string(b))
 }
 
+func TestAlertLaunchImageWithStringAlert(t *testing.T) {
+	payload := NewPayload().Alert("hello").AlertLaunchImage("Default.png")
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"alert":{"body":"hello","launch-image":"Default.png"}}}`, string(b))
+}
+
 func TestAlertLocKey(t *testing.T) {
 	payload := NewPayload().AlertLocKey("LOC")
 	b, _ := json.Marshal(payload)
@@ -152,18 +159,48 @@ func TestMdm(t *testing.T) {
 	assert.Equal(t, `{"aps":{},"mdm":"996ac527-9993-4a0a-8528-60b2b3c2f52b"}`, string(b))
 }
 
+func TestTargetContentID(t *testing.T) {
+	payload := NewPayload().TargetContentID("window-1")
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"target-content-id":"window-1"}}`, string(b))
+}
+
+func TestTargetContentIDOmitted(t *testing.T) {
+	payload := NewPayload().TargetContentID("")
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{}}`, string(b))
+}
+
 func TestThreadID(t *testing.T) {
 	payload := NewPayload().ThreadID("THREAD_ID")
 	b, _ := json.Marshal(payload)
 	assert.Equal(t, `{"aps":{"thread-id":"THREAD_ID"}}`, string(b))
 }
 
+func TestCategoryAndThreadID(t *testing.T) {
+	payload := NewPayload().Category("NEW_MESSAGE_CATEGORY").ThreadID("THREAD_ID")
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"category":"NEW_MESSAGE_CATEGORY","thread-id":"THREAD_ID"}}`, string(b))
+}
+
+func TestCategoryAndThreadIDOmitted(t *testing.T) {
+	payload := NewPayload().Category("").ThreadID("")
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{}}`, string(b))
+}
+
 func TestURLArgs(t *testing.T) {
 	payload := NewPayload().URLArgs([]string{"a", "b"})
 	b, _ := json.Marshal(payload)
 	assert.Equal(t, `{"aps":{"url-args":["a","b"]}}`, string(b))
 }
 
+func TestURLArgsOmitted(t *testing.T) {
+	payload := NewPayload().URLArgs(nil)
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{}}`, string(b))
+}
+
 func TestSoundName(t *testing.T) {
 	payload := NewPayload().SoundName("test")
 	b, _ := json.Marshal(payload)
@@ -188,6 +225,12 @@ func TestAlertSummaryArgCount(t *testing.T) {
 	assert.Equal(t, `{"aps":{"alert":{"summary-arg-count":3}}}`, string(b))
 }
 
+func TestAlertSummaryArgWithCount(t *testing.T) {
+	payload := NewPayload().AlertBody("New photo").AlertSummaryArg("Robert").AlertSummaryArgCount(3)
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"alert":{"body":"New photo","summary-arg":"Robert","summary-arg-count":3}}}`, string(b))
+}
+
 func TestInterruptionLevelPassive(t *testing.T) {
 	payload := NewPayload().InterruptionLevel(InterruptionLevelPassive)
 	b, _ := json.Marshal(payload)
@@ -235,3 +278,68 @@ func TestCombined(t *testing.T) {
 	b, _ := json.Marshal(payload)
 	assert.Equal(t, `{"aps":{"alert":"hello","badge":1,"interruption-level":"active","relevance-score":0.1,"sound":"Default.caf"},"key":"val"}`, string(b))
 }
+
+func TestValidateUTF8(t *testing.T) {
+	payload := NewPayload().AlertTitle("héllo").AlertSubtitle("wörld").AlertBody("ünïcode")
+	assert.NoError(t, payload.Validate())
+}
+
+func TestValidateInvalidUTF8(t *testing.T) {
+	scenarios := []*Payload{
+		NewPayload().Alert("bad \xff alert"),
+		NewPayload().AlertTitle("bad \xc3\x28 title"),
+		NewPayload().AlertSubtitle("bad \xe2\x82 subtitle"),
+		NewPayload().AlertBody("bad \xf0\x28\x8c\x28 body"),
+	}
+	for _, payload := range scenarios {
+		err := payload.Validate()
+		assert.Error(t, err)
+		assert.True(t, errors.Is(err, ErrInvalidUTF8))
+	}
+	assert.EqualError(t, NewPayload().AlertBody("\xff").Validate(), "payload: alert text is not valid UTF-8: alert body")
+}
+
+func TestEscapeHTMLByDefault(t *testing.T) {
+	payload := NewPayload().Alert("Tom & Jerry <3")
+	b, _ := json.Marshal(payload)
+	assert.Equal(t, `{"aps":{"alert":"Tom \u0026 Jerry \u003c3"}}`, string(b))
+}
+
+func TestDisableHTMLEscape(t *testing.T) {
+	payload := NewPayload().Alert("Tom & Jerry <3").DisableHTMLEscape()
+	b, err := payload.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"aps":{"alert":"Tom & Jerry <3"}}`, string(b))
+}
+
+func TestReset(t *testing.T) {
+	payload := NewPayload().Alert("Tom & Jerry").Badge(1).SoundName("ping").Custom("key", "val").DisableHTMLEscape()
+	b, _ := json.Marshal(payload.Reset())
+	assert.Equal(t, `{"aps":{}}`, string(b))
+
+	b, _ = json.Marshal(payload.Alert("Tom & Jerry"))
+	assert.Equal(t, `{"aps":{"alert":"Tom \u0026 Jerry"}}`, string(b))
+}
+
+func TestParseInterruptionLevel(t *testing.T) {
+	for _, level := range []EInterruptionLevel{
+		InterruptionLevelPassive,
+		InterruptionLevelActive,
+		InterruptionLevelTimeSensitive,
+		InterruptionLevelCritical,
+	} {
+		parsed, err := ParseInterruptionLevel(string(level))
+		assert.NoError(t, err)
+		assert.Equal(t, level, parsed)
+		assert.True(t, parsed.IsValid())
+	}
+}
+
+func TestParseInterruptionLevelUnknown(t *testing.T) {
+	for _, s := range []string{"", "urgent", "Active"} {
+		parsed, err := ParseInterruptionLevel(s)
+		assert.True(t, errors.Is(err, ErrInvalidInterruptionLevel), s)
+		assert.Equal(t, EInterruptionLevel(""), parsed)
+		assert.False(t, EInterruptionLevel(s).IsValid(), s)
+	}
+}
@@ -0,0 +1,56 @@
+package apns2
+
+import "sort"
+
+var reasonDescriptions = map[string]string{
+	ReasonBadCollapseID:               "The collapse identifier exceeds the maximum allowed size.",
+	ReasonBadDeviceToken:              "The device token is bad, or does not match the environment.",
+	ReasonBadExpirationDate:           "The apns-expiration value is bad.",
+	ReasonBadMessageID:                "The apns-id value is bad.",
+	ReasonBadPriority:                 "The apns-priority value is bad.",
+	ReasonBadTopic:                    "The apns-topic value is invalid.",
+	ReasonDeviceTokenNotForTopic:      "The device token does not match the topic.",
+	ReasonDuplicateHeaders:            "One or more headers were repeated.",
+	ReasonIdleTimeout:                 "The connection was idle for too long.",
+	ReasonInvalidPushType:             "The apns-push-type value is invalid.",
+	ReasonMissingDeviceToken:          "The device token is missing from the request path.",
+	ReasonMissingTopic:                "The apns-topic header is required but was not set.",
+	ReasonPayloadEmpty:                "The payload is empty.",
+	ReasonTopicDisallowed:             "Pushing to this topic is not allowed.",
+	ReasonMissingChannelID:            "The apns-channel-id header is required but was not set.",
+	ReasonBadChannelID:                "The apns-channel-id value is bad.",
+	ReasonChannelNotRegistered:        "The broadcast channel is not registered.",
+	ReasonBadCertificate:              "The certificate is bad.",
+	ReasonBadCertificateEnvironment:   "The certificate is for the wrong environment.",
+	ReasonExpiredProviderToken:        "The provider token is stale and a new one should be generated.",
+	ReasonForbidden:                   "The action is not allowed.",
+	ReasonInvalidProviderToken:        "The provider token is invalid or its signature could not be verified.",
+	ReasonMissingProviderToken:        "No certificate or provider token was used to authenticate.",
+	ReasonBadPath:                     "The request path is bad.",
+	ReasonMethodNotAllowed:            "The request method was not POST.",
+	ReasonUnregistered:                "The device token is no longer active for the topic.",
+	ReasonExpiredToken:                "The device token has expired.",
+	ReasonPayloadTooLarge:             "The payload is too large.",
+	ReasonTooManyProviderTokenUpdates: "The provider token is being updated too often.",
+	ReasonTooManyRequests:             "Too many requests were made to the same device token.",
+	ReasonInternalServerError:         "APNs had an internal server error.",
+	ReasonServiceUnavailable:          "APNs is unavailable.",
+	ReasonShutdown:                    "The APNs server is shutting down.",
+}
+
+// Reasons returns every reason APNs is known to return, in alphabetical
+// order.
+func Reasons() []string {
+	reasons := make([]string, 0, len(reasonDescriptions))
+	for reason := range reasonDescriptions {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// ReasonDescription returns a human readable description of a reason returned
+// by APNs, such as ReasonBadDeviceToken, or "" if the reason is not known.
+func ReasonDescription(reason string) string {
+	return reasonDescriptions[reason]
+}
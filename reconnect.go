@@ -0,0 +1,104 @@
+package apns2
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+var (
+	// ReconnectBackoff is how long a push waits before reconnecting after the
+	// previous push failed because its connection was lost, such as when APNs
+	// sends GOAWAY while cycling connections. It doubles after each
+	// consecutive failure, up to MaxReconnectBackoff, so that a failing
+	// connection is not retried in a hot loop.
+	ReconnectBackoff = 50 * time.Millisecond
+
+	// MaxReconnectBackoff is the longest a push waits before reconnecting.
+	MaxReconnectBackoff = 2 * time.Second
+)
+
+// connectionLost reports whether err means the connection a push was sent
+// over can no longer be used: APNs sent GOAWAY or an HTTP/2 connection error,
+// or the connection failed or was closed at the network level.
+func connectionLost(err error) bool {
+	var goAway http2.GoAwayError
+	var connErr http2.ConnectionError
+	var opErr *net.OpError
+	return errors.As(err, &goAway) || errors.As(err, &connErr) || errors.As(err, &opErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// connectionFailed records a lost connection and drops idle connections from
+// the pool, so that the next push dials a new one.
+func (c *Client) connectionFailed() {
+	c.mu.Lock()
+	c.connFailures++
+	c.mu.Unlock()
+	if closer, ok := c.HTTPClient.Transport.(connectionCloser); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// connectionSucceeded resets the reconnection backoff.
+func (c *Client) connectionSucceeded() {
+	c.mu.Lock()
+	c.connFailures = 0
+	c.mu.Unlock()
+}
+
+// reconnectDelay returns how long the next push should wait before sending.
+func (c *Client) reconnectDelay() time.Duration {
+	c.mu.Lock()
+	failures := c.connFailures
+	c.mu.Unlock()
+	if failures == 0 {
+		return 0
+	}
+	d := ReconnectBackoff
+	for i := 1; i < failures && d < MaxReconnectBackoff; i++ {
+		d *= 2
+	}
+	if d > MaxReconnectBackoff {
+		d = MaxReconnectBackoff
+	}
+	return d
+}
+
+// WithIdleConnTimeout makes the Client drop connections which have been idle
+// for longer than d, so that a push after a quiet period dials a fresh
+// connection rather than failing on one an intermediary has silently dropped.
+// An *http.Transport closes such connections itself. As the HTTP/2 transport
+// has no idle timeout of its own, a Client using one instead closes its idle
+// connections before a push made more than d after the previous one.
+func (c *Client) WithIdleConnTimeout(d time.Duration) *Client {
+	c.idleTimeout = d
+	if t, ok := c.HTTPClient.Transport.(*http.Transport); ok {
+		t.IdleConnTimeout = d
+	}
+	return c
+}
+
+// recycleIdleConnections closes idle connections from the pool if the Client
+// has not pushed for longer than its idle timeout.
+func (c *Client) recycleIdleConnections() {
+	if c.idleTimeout <= 0 {
+		return
+	}
+	now := c.now()
+	c.mu.Lock()
+	idle := !c.lastUse.IsZero() && now.Sub(c.lastUse) > c.idleTimeout
+	c.lastUse = now
+	c.mu.Unlock()
+	if !idle {
+		return
+	}
+	if closer, ok := c.HTTPClient.Transport.(connectionCloser); ok {
+		closer.CloseIdleConnections()
+	}
+	c.closeCertificateClients()
+}
@@ -0,0 +1,138 @@
+package apns2_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apns "github.com/mkc-bill/apns2"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+)
+
+// goAwayTransport fails the first request as if APNs had sent GOAWAY.
+type goAwayTransport struct {
+	calls  int32
+	closed int32
+}
+
+func (t *goAwayTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if atomic.AddInt32(&t.calls, 1) == 1 {
+		return nil, http2.GoAwayError{ErrCode: http2.ErrCodeNo, DebugData: "cycling"}
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+func (t *goAwayTransport) CloseIdleConnections() {
+	atomic.AddInt32(&t.closed, 1)
+}
+
+func TestReconnectAfterGoAway(t *testing.T) {
+	defer func(d time.Duration) { apns.ReconnectBackoff = d }(apns.ReconnectBackoff)
+	apns.ReconnectBackoff = 20 * time.Millisecond
+
+	transport := &goAwayTransport{}
+	client := &apns.Client{Host: "https://localhost", HTTPClient: &http.Client{Transport: transport}}
+
+	_, err := client.Push(mockNotification())
+	var netErr *apns.NetworkError
+	assert.True(t, errors.As(err, &netErr))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&transport.closed))
+
+	start := time.Now()
+	res, err := client.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.True(t, res.Sent())
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+
+	start = time.Now()
+	_, err = client.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < 20*time.Millisecond)
+}
+
+// failingTransport fails every request with err.
+type failingTransport struct {
+	err    error
+	closed int32
+}
+
+func (t *failingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+func (t *failingTransport) CloseIdleConnections() {
+	atomic.AddInt32(&t.closed, 1)
+}
+
+func TestConnectionLostErrors(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		lost bool
+	}{
+		{http2.GoAwayError{ErrCode: http2.ErrCodeNo}, true},
+		{http2.ConnectionError(http2.ErrCodeProtocol), true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, true},
+		{io.EOF, true},
+		{io.ErrUnexpectedEOF, true},
+		{errors.New("http2: client conn is closed"), false},
+		{errors.New("x509: certificate signed by unknown authority"), false},
+	} {
+		transport := &failingTransport{err: tt.err}
+		client := &apns.Client{Host: "https://localhost", HTTPClient: &http.Client{Transport: transport}}
+		_, err := client.Push(mockNotification())
+		assert.Error(t, err)
+		assert.Equal(t, tt.lost, atomic.LoadInt32(&transport.closed) == 1, tt.err.Error())
+	}
+}
+
+func TestWithIdleConnTimeoutHTTPTransport(t *testing.T) {
+	transport := &http.Transport{}
+	client := &apns.Client{HTTPClient: &http.Client{Transport: transport}}
+	client.WithIdleConnTimeout(90 * time.Second)
+	assert.Equal(t, 90*time.Second, transport.IdleConnTimeout)
+}
+
+func TestWithIdleConnTimeoutRecyclesConnection(t *testing.T) {
+	// The HTTP/2 transport only treats a connection as idle once its streams
+	// have closed. A response with a body makes closing it wait for that,
+	// rather than the stream finishing after the push has returned, and
+	// without the Client timeout nothing cuts that wait short.
+	var connections int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	server.EnableHTTP2 = true
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+	clock := mockClock(1680000000)
+	client := mockTLSClient(server).WithClock(clock).WithIdleConnTimeout(time.Minute)
+	client.HTTPClient.Timeout = 0
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Push(mockNotification())
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&connections))
+
+	clock.Advance(time.Minute + time.Second)
+	_, err := client.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&connections))
+}
@@ -1,6 +1,8 @@
 package apns2
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"net/http"
 	"strconv"
 	"time"
@@ -58,6 +60,15 @@ const (
 	// 400 Pushing to this topic is not allowed.
 	ReasonTopicDisallowed = "TopicDisallowed"
 
+	// 400 The apns-channel-id header of a broadcast request was not specified.
+	ReasonMissingChannelID = "MissingChannelId"
+
+	// 400 The apns-channel-id value is bad.
+	ReasonBadChannelID = "BadChannelId"
+
+	// 400 The broadcast channel is not registered for the bundle ID.
+	ReasonChannelNotRegistered = "ChannelNotRegistered"
+
 	// 403 The certificate was bad.
 	ReasonBadCertificate = "BadCertificate"
 
@@ -87,6 +98,9 @@ const (
 	// 410 The device token is inactive for the specified topic.
 	ReasonUnregistered = "Unregistered"
 
+	// 410 The device token has expired.
+	ReasonExpiredToken = "ExpiredToken"
+
 	// 413 The message payload was too large. See Creating the Remote Notification
 	// Payload in the Apple Local and Remote Notification Programming Guide for
 	// details on maximum payload size.
@@ -132,9 +146,31 @@ type Response struct {
 	// liveacvitity returns the unique identifier of the notification.
 	ApnsUniqueId string
 
+	// The broadcast channel the response relates to, taken from the
+	// apns-channel-id response header. It is set when creating a channel or
+	// sending a broadcast, and is empty otherwise.
+	ChannelID string
+
+	// The priority APNs reports it applied to the notification, taken from the
+	// apns-priority response header if present. This is useful when
+	// investigating throttling of Live Activity updates. It is 0 if APNs did
+	// not return the header.
+	EffectivePriority int
+
 	// If the value of StatusCode is 410, this is the last time at which APNs
 	// confirmed that the device token was no longer valid for the topic.
 	Timestamp Time
+
+	// The state of the TLS connection the notification was sent over, such as
+	// the negotiated version and cipher suite. It is nil if the connection did
+	// not use TLS.
+	TLS *tls.ConnectionState `json:"-"`
+
+	// The raw response body exactly as returned by the server, for example
+	// for an audit trail. This is kept even when the body could not be
+	// decoded, such as an HTML error page returned by a proxy in front of
+	// APNs. It is empty for a 200 response, which has no body.
+	RawBody []byte `json:"-"`
 }
 
 // Sent returns whether or not the notification was successfully sent.
@@ -143,6 +179,48 @@ func (c *Response) Sent() bool {
 	return c.StatusCode == StatusSent
 }
 
+// Err returns an *APNsError describing the rejection if the notification was
+// not sent, or nil if it was.
+func (c *Response) Err() error {
+	if c.Sent() {
+		return nil
+	}
+	return &APNsError{StatusCode: c.StatusCode, Reason: c.Reason, ApnsID: c.ApnsID}
+}
+
+// Retriable returns whether the notification was rejected for a reason that
+// is likely to go away if it is pushed again later: being throttled with a
+// 429, or an error on the APNs side with a 5xx status. Other rejections,
+// such as a bad device token or topic, fail the same way every time. A sent
+// notification is not retriable.
+func (c *Response) Retriable() bool {
+	return c.StatusCode == http.StatusTooManyRequests || c.StatusCode >= http.StatusInternalServerError
+}
+
+// UUID returns the ApnsID parsed as a UUID, or ErrInvalidUUID if it is
+// missing or malformed.
+func (c *Response) UUID() (UUID, error) {
+	return ParseUUID(c.ApnsID)
+}
+
+// decodeBody decodes the JSON response body into the Response. An error
+// response whose body is not valid JSON is tolerated so that the HTTP status
+// is preserved; the body itself remains available in RawBody.
+func (c *Response) decodeBody() error {
+	if len(c.RawBody) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(c.RawBody, c); err != nil {
+		if c.StatusCode != StatusSent {
+			if _, ok := err.(*json.SyntaxError); ok {
+				return nil
+			}
+		}
+		return err
+	}
+	return nil
+}
+
 // Time represents a device uninstall time
 type Time struct {
 	time.Time
@@ -2,6 +2,7 @@ package apns2_test
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"testing"
 
@@ -17,6 +18,36 @@ func TestResponseSent(t *testing.T) {
 	assert.Equal(t, false, (&apns.Response{StatusCode: 400}).Sent())
 }
 
+func TestResponseErr(t *testing.T) {
+	assert.NoError(t, (&apns.Response{StatusCode: 200}).Err())
+	err := (&apns.Response{StatusCode: 410, Reason: apns.ReasonUnregistered}).Err()
+	assert.IsType(t, &apns.APNsError{}, err)
+	assert.EqualError(t, err, "apns2: notification rejected with status 410: Unregistered")
+	assert.EqualError(t, (&apns.Response{StatusCode: 503}).Err(), "apns2: notification rejected with status 503")
+}
+
+func TestResponseErrPayloadTooLarge(t *testing.T) {
+	err := (&apns.Response{StatusCode: http.StatusRequestEntityTooLarge, Reason: apns.ReasonPayloadTooLarge}).Err()
+	assert.True(t, errors.Is(err, apns.ErrPayloadTooLarge))
+	assert.True(t, errors.Is((&apns.Response{StatusCode: http.StatusRequestEntityTooLarge}).Err(), apns.ErrPayloadTooLarge))
+	assert.False(t, errors.Is((&apns.Response{StatusCode: 400, Reason: apns.ReasonBadDeviceToken}).Err(), apns.ErrPayloadTooLarge))
+}
+
+func TestResponseRetriable(t *testing.T) {
+	for status, want := range map[int]bool{
+		200: false,
+		400: false,
+		403: false,
+		410: false,
+		413: false,
+		429: true,
+		500: true,
+		503: true,
+	} {
+		assert.Equal(t, want, (&apns.Response{StatusCode: status}).Retriable(), status)
+	}
+}
+
 func TestIntTimestampParse(t *testing.T) {
 	response := &apns.Response{}
 	payload := "{\"reason\":\"Unregistered\", \"timestamp\":1458114061260}"
@@ -30,3 +61,15 @@ func TestInvalidTimestampParse(t *testing.T) {
 	err := json.Unmarshal([]byte(payload), &response)
 	assert.Error(t, err)
 }
+
+func TestReasonDescriptions(t *testing.T) {
+	reasons := apns.Reasons()
+	assert.Len(t, reasons, 33)
+	assert.Contains(t, reasons, apns.ReasonBadDeviceToken)
+	assert.Contains(t, reasons, apns.ReasonExpiredToken)
+	assert.Contains(t, reasons, apns.ReasonShutdown)
+	for _, reason := range reasons {
+		assert.NotEmpty(t, apns.ReasonDescription(reason), reason)
+	}
+	assert.Equal(t, "", apns.ReasonDescription("NotAReason"))
+}
@@ -0,0 +1,112 @@
+package apns2
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// StatusResponse describes the outcome of a Client.Status probe.
+type StatusResponse struct {
+	// Whether the Client was able to reach the APNs host and receive an HTTP
+	// response.
+	Reachable bool
+
+	// Whether APNs appears healthy. This is true when APNs responded with
+	// anything other than a server error, as a rejection of the probe still
+	// shows the service is accepting requests.
+	Healthy bool
+
+	// The HTTP status code returned by APNs, or 0 if it was not reachable.
+	StatusCode int
+
+	// The APNs error string returned for the probe, if any.
+	Reason string
+
+	// How long the probe took.
+	Latency time.Duration
+}
+
+// Status performs a lightweight probe of the Client's APNs host to check it is
+// reachable and healthy, for example before starting a large campaign. The
+// probe is a push request without a device token, which APNs always rejects,
+// so no notification is delivered.
+//
+// If the host cannot be reached, a StatusResponse with Reachable set to false
+// is returned along with a *NetworkError describing the failure.
+func (c *Client) Status(ctx Context) (*StatusResponse, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Host+"/3/device/", bytes.NewReader([]byte("{}")))
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != nil {
+		setTokenHeader(request, c.Token)
+	}
+
+	start := time.Now()
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return &StatusResponse{Latency: time.Since(start)}, &NetworkError{Err: err}
+	}
+	defer response.Body.Close()
+	status := &StatusResponse{
+		Reachable:  true,
+		Healthy:    response.StatusCode < http.StatusInternalServerError,
+		StatusCode: response.StatusCode,
+		Latency:    time.Since(start),
+	}
+
+	body, _ := ioutil.ReadAll(response.Body)
+	var r Response
+	if json.Unmarshal(body, &r) == nil {
+		status.Reason = r.Reason
+	}
+	return status, nil
+}
+
+// Warmup front-loads the cost of the first push, such as before a campaign,
+// by generating the Client's provider token, if it has one, and establishing
+// the connection to its APNs host with a Status probe. Later pushes reuse the
+// connection for as long as it is kept alive.
+//
+// An error is returned if the token cannot be signed or the host cannot be
+// reached. A rejection of the probe by APNs is not an error.
+func (c *Client) Warmup(ctx Context) error {
+	if c.Token != nil {
+		c.Token.Lock()
+		var err error
+		if c.Token.Expired() {
+			_, err = c.Token.Generate()
+		}
+		c.Token.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	_, err := c.Status(ctx)
+	return err
+}
+
+// LastError returns the most recent error the Client observed pushing to the
+// APNs host, such as HostProduction or HostDevelopment, or nil if none has
+// been observed. Both network failures, as *NetworkError, and rejections by
+// APNs, as *APNsError, are recorded. A later successful push does not clear
+// the error, so it is suited to dashboards and health checks rather than to
+// deciding whether the host is currently healthy.
+func (c *Client) LastError(host string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastErrs[host]
+}
+
+// recordError records err as the last error observed for the Client's host.
+func (c *Client) recordError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastErrs == nil {
+		c.lastErrs = map[string]error{}
+	}
+	c.lastErrs[c.Host] = err
+}
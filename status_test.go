@@ -0,0 +1,113 @@
+package apns2_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	apns "github.com/mkc-bill/apns2"
+	"github.com/mkc-bill/apns2/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusHealthy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/3/device/", r.URL.Path)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"reason":"MissingDeviceToken"}`))
+	}))
+	defer server.Close()
+	status, err := mockClient(server.URL).Status(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, status.Reachable)
+	assert.True(t, status.Healthy)
+	assert.Equal(t, http.StatusBadRequest, status.StatusCode)
+	assert.Equal(t, apns.ReasonMissingDeviceToken, status.Reason)
+}
+
+func TestStatusUnhealthy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"reason":"ServiceUnavailable"}`))
+	}))
+	defer server.Close()
+	status, err := mockClient(server.URL).Status(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, status.Reachable)
+	assert.False(t, status.Healthy)
+	assert.Equal(t, apns.ReasonServiceUnavailable, status.Reason)
+}
+
+func TestStatusUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	status, err := mockClient(server.URL).Status(context.Background())
+	var networkErr *apns.NetworkError
+	assert.True(t, errors.As(err, &networkErr))
+	assert.False(t, status.Reachable)
+	assert.False(t, status.Healthy)
+	assert.Equal(t, 0, status.StatusCode)
+}
+
+func TestWarmup(t *testing.T) {
+	server, connections := mockCountingTLSServer()
+	defer server.Close()
+	client := mockTLSClient(server)
+	client.Token = mockToken()
+	assert.NoError(t, client.Warmup(context.Background()))
+	assert.NotEmpty(t, client.Token.Bearer)
+	assert.Equal(t, int32(1), atomic.LoadInt32(connections))
+
+	bearer := client.Token.Bearer
+	_, err := client.Push(mockNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(connections))
+	assert.Equal(t, bearer, client.Token.Bearer)
+}
+
+func TestWarmupTokenError(t *testing.T) {
+	server, connections := mockCountingTLSServer()
+	defer server.Close()
+	client := mockTLSClient(server)
+	client.Token = &token.Token{}
+	assert.Equal(t, token.ErrAuthKeyNil, client.Warmup(context.Background()))
+	assert.Equal(t, int32(0), atomic.LoadInt32(connections))
+}
+
+func TestWarmupUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	var networkErr *apns.NetworkError
+	assert.True(t, errors.As(mockClient(server.URL).Warmup(context.Background()), &networkErr))
+}
+
+func TestLastErrorRejection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"reason":"BadDeviceToken"}`))
+	}))
+	defer server.Close()
+	client := mockClient(server.URL)
+	assert.NoError(t, client.LastError(server.URL))
+
+	_, err := client.Push(mockNotification())
+	assert.NoError(t, err)
+	var apnsErr *apns.APNsError
+	assert.True(t, errors.As(client.LastError(server.URL), &apnsErr))
+	assert.Equal(t, apns.ReasonBadDeviceToken, apnsErr.Reason)
+	assert.NoError(t, client.LastError(apns.HostProduction))
+}
+
+func TestLastErrorNetwork(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	client := mockClient(server.URL)
+
+	_, err := client.Push(mockNotification())
+	assert.Error(t, err)
+	var netErr *apns.NetworkError
+	assert.True(t, errors.As(client.LastError(server.URL), &netErr))
+}
@@ -0,0 +1,54 @@
+package apns2
+
+import "sync"
+
+// PushResult is the outcome of a notification sent through PushStream.
+type PushResult struct {
+	// The Notification that was sent.
+	Notification *Notification
+
+	// The Response from APNs, or nil if Err is set.
+	Response *Response
+
+	// Any error returned while sending the Notification.
+	Err error
+}
+
+// PushStream starts sending notifications as they are fed into the returned
+// input channel, reporting the outcome of each on the returned results
+// channel. Up to DefaultBatchConcurrency pushes are in flight at once, and
+// both channels are buffered by the same amount, so a producer blocks once
+// the results are not being consumed fast enough. Results arrive in the order
+// the pushes complete, not the order they were fed in.
+//
+// Close the input channel when done; the results channel is closed once every
+// notification fed in has been sent and reported. The results must be
+// drained, or the stream stalls. Cancelling ctx fails the remaining pushes
+// rather than dropping them, so each notification still yields a result.
+func (c *Client) PushStream(ctx Context) (chan<- *Notification, <-chan PushResult) {
+	concurrency := DefaultBatchConcurrency
+	in := make(chan *Notification, concurrency)
+	out := make(chan PushResult, concurrency)
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for n := range in {
+				result := PushResult{Notification: n}
+				payload, err := n.marshalPayload(c.timestampNow())
+				if err == nil {
+					result.Response, result.Err = c.push(ctx, n, payload)
+				} else {
+					result.Err = err
+				}
+				out <- result
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return in, out
+}
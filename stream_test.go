@@ -0,0 +1,67 @@
+package apns2_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apns "github.com/mkc-bill/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	in, out := mockClient(server.URL).PushStream(context.Background())
+	const count = 50
+	go func() {
+		for i := 0; i < count; i++ {
+			in <- mockNotification()
+		}
+		close(in)
+	}()
+
+	results := 0
+	for result := range out {
+		assert.NoError(t, result.Err)
+		assert.True(t, result.Response.Sent())
+		assert.NotNil(t, result.Notification)
+		results++
+	}
+	assert.Equal(t, count, results)
+}
+
+func TestPushStreamBadPayload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	in, out := mockClient(server.URL).PushStream(context.Background())
+	bad := mockNotification()
+	bad.Payload = func() {}
+	in <- bad
+	close(in)
+
+	result := <-out
+	assert.Equal(t, bad, result.Notification)
+	assert.Error(t, result.Err)
+	assert.Nil(t, result.Response)
+	_, open := <-out
+	assert.False(t, open)
+}
+
+func TestPushStreamCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	in, out := mockClient(server.URL).PushStream(ctx)
+	in <- mockNotification()
+	close(in)
+
+	result := <-out
+	var netErr *apns.NetworkError
+	assert.ErrorAs(t, result.Err, &netErr)
+}
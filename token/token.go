@@ -2,6 +2,7 @@ package token
 
 import (
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
@@ -16,7 +17,9 @@ const (
 	// TokenTimeout is the period of time in seconds that a token is valid for.
 	// If the timestamp for token issue is not within the last hour, APNs
 	// rejects subsequent push messages. This is set to under an hour so that
-	// we generate a new token before the existing one expires.
+	// we generate a new token before the existing one expires, leaving ten
+	// minutes to spare so that a bearer never expires while a push sent with
+	// it is still in flight.
 	TokenTimeout = 3000
 )
 
@@ -25,6 +28,8 @@ var (
 	ErrAuthKeyNotPem   = errors.New("token: AuthKey must be a valid .p8 PEM file")
 	ErrAuthKeyNotECDSA = errors.New("token: AuthKey must be of type ecdsa.PrivateKey")
 	ErrAuthKeyNil      = errors.New("token: AuthKey was nil")
+	ErrAuthKeyNotP256  = errors.New("token: AuthKey must be an EC key on the P-256 curve")
+	ErrInvalidKeyID    = errors.New("token: KeyID must be 10 uppercase letters or digits")
 )
 
 // Token represents an Apple Provider Authentication Token (JSON Web Token).
@@ -35,6 +40,43 @@ type Token struct {
 	TeamID   string
 	IssuedAt int64
 	Bearer   string
+
+	onRefresh func(generatedAt time.Time)
+	clock     Clock
+}
+
+// Clock tells the current time. A Token uses the system clock unless another
+// is set with WithClock, for example to freeze time in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// New returns a Token for the signing key, key ID and team ID from your
+// developer account, after checking that they are usable. The key must be an
+// EC key on the P-256 curve, as APNs only accepts ES256 signatures, and the
+// key ID must be in Apple's 10 character format.
+func New(authKey *ecdsa.PrivateKey, keyID, teamID string) (*Token, error) {
+	t := &Token{AuthKey: authKey, KeyID: keyID, TeamID: teamID}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Validate checks that the signing key is an EC key on the P-256 curve and
+// that the key ID is 10 uppercase letters or digits, so that a misconfigured
+// token is caught before it produces bearers APNs rejects.
+func (t *Token) Validate() error {
+	if t.AuthKey == nil {
+		return ErrAuthKeyNil
+	}
+	if t.AuthKey.Curve != elliptic.P256() {
+		return ErrAuthKeyNotP256
+	}
+	if !validKeyID(t.KeyID) {
+		return ErrInvalidKeyID
+	}
+	return nil
 }
 
 // AuthKeyFromFile loads a .p8 certificate from a local file and returns a
@@ -64,6 +106,26 @@ func AuthKeyFromBytes(bytes []byte) (*ecdsa.PrivateKey, error) {
 	return nil, ErrAuthKeyNotECDSA
 }
 
+// OnRefresh registers fn to be called each time a new bearer is signed, with
+// the time it was issued. This can be used to monitor how often the token is
+// refreshed, for example to correlate with TooManyProviderTokenUpdates
+// responses. fn is called while the token is locked, so it must not call
+// methods on the Token.
+func (t *Token) OnRefresh(fn func(generatedAt time.Time)) {
+	t.Lock()
+	defer t.Unlock()
+	t.onRefresh = fn
+}
+
+// WithClock sets the clock used to stamp newly generated bearers and to decide
+// when the token has expired.
+func (t *Token) WithClock(clock Clock) *Token {
+	t.Lock()
+	defer t.Unlock()
+	t.clock = clock
+	return t
+}
+
 // GenerateIfExpired checks to see if the token is about to expire and
 // generates a new token.
 func (t *Token) GenerateIfExpired() (bearer string) {
@@ -77,7 +139,26 @@ func (t *Token) GenerateIfExpired() (bearer string) {
 
 // Expired checks to see if the token has expired.
 func (t *Token) Expired() bool {
-	return time.Now().Unix() >= (t.IssuedAt + TokenTimeout)
+	return t.now().Unix() >= (t.IssuedAt + TokenTimeout)
+}
+
+// Rotate atomically swaps the signing key and key ID used by the token and
+// immediately generates a new bearer signed with them. Pushes already in
+// flight keep the bearer they were sent with. If a new bearer cannot be
+// generated the previous signing material is kept.
+func (t *Token) Rotate(authKey *ecdsa.PrivateKey, keyID string) error {
+	t.Lock()
+	defer t.Unlock()
+	if authKey == nil {
+		return ErrAuthKeyNil
+	}
+	prevKey, prevKeyID := t.AuthKey, t.KeyID
+	t.AuthKey, t.KeyID = authKey, keyID
+	if _, err := t.Generate(); err != nil {
+		t.AuthKey, t.KeyID = prevKey, prevKeyID
+		return err
+	}
+	return nil
 }
 
 // Generate creates a new token.
@@ -85,7 +166,7 @@ func (t *Token) Generate() (bool, error) {
 	if t.AuthKey == nil {
 		return false, ErrAuthKeyNil
 	}
-	issuedAt := time.Now().Unix()
+	issuedAt := t.now().Unix()
 	jwtToken := &jwt.Token{
 		Header: map[string]interface{}{
 			"alg": "ES256",
@@ -103,5 +184,27 @@ func (t *Token) Generate() (bool, error) {
 	}
 	t.IssuedAt = issuedAt
 	t.Bearer = bearer
+	if t.onRefresh != nil {
+		t.onRefresh(time.Unix(issuedAt, 0))
+	}
 	return true, nil
 }
+
+func (t *Token) now() time.Time {
+	if t.clock == nil {
+		return time.Now()
+	}
+	return t.clock.Now()
+}
+
+func validKeyID(keyID string) bool {
+	if len(keyID) != 10 {
+		return false
+	}
+	for _, c := range keyID {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/mkc-bill/apns2/token"
 	"github.com/stretchr/testify/assert"
 )
@@ -44,7 +45,36 @@ func TestInvalidPKCS8P8File(t *testing.T) {
 
 func TestInvalidECDSAP8File(t *testing.T) {
 	_, err := token.AuthKeyFromFile("_fixtures/authkey-invalid-ecdsa.p8")
-	assert.Error(t, err)
+	assert.Equal(t, token.ErrAuthKeyNotECDSA, err)
+}
+
+// Validation
+
+func TestNewToken(t *testing.T) {
+	authKey, _ := token.AuthKeyFromFile("_fixtures/authkey-valid.p8")
+	tkn, err := token.New(authKey, "ABC123DEFG", "DEF123GHIJ")
+	assert.NoError(t, err)
+	assert.Equal(t, "ABC123DEFG", tkn.KeyID)
+	assert.Equal(t, "DEF123GHIJ", tkn.TeamID)
+}
+
+func TestNewTokenInvalidKeyID(t *testing.T) {
+	authKey, _ := token.AuthKeyFromFile("_fixtures/authkey-valid.p8")
+	for _, keyID := range []string{"", "ABC123DEF", "ABC123DEFGH", "abc123defg", "ABC-23DEFG"} {
+		_, err := token.New(authKey, keyID, "DEF123GHIJ")
+		assert.Equal(t, token.ErrInvalidKeyID, err, keyID)
+	}
+}
+
+func TestNewTokenWrongCurve(t *testing.T) {
+	authKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, err := token.New(authKey, "ABC123DEFG", "DEF123GHIJ")
+	assert.Equal(t, token.ErrAuthKeyNotP256, err)
+}
+
+func TestNewTokenNilKey(t *testing.T) {
+	_, err := token.New(nil, "ABC123DEFG", "DEF123GHIJ")
+	assert.Equal(t, token.ErrAuthKeyNil, err)
 }
 
 // Expiry & Generation
@@ -73,8 +103,22 @@ func TestGenerateIfExpired(t *testing.T) {
 	token := &token.Token{
 		AuthKey: authKey,
 	}
-	token.GenerateIfExpired()
-	assert.Equal(t, time.Now().Unix(), token.IssuedAt)
+	token.WithClock(clock{time.Unix(1680000000, 0)}).GenerateIfExpired()
+	assert.Equal(t, int64(1680000000), token.IssuedAt)
+}
+
+type clock struct {
+	now time.Time
+}
+
+func (c clock) Now() time.Time { return c.now }
+
+func TestExpiredWithClock(t *testing.T) {
+	tkn := &token.Token{IssuedAt: 1680000000}
+	tkn.WithClock(clock{time.Unix(1680000000+token.TokenTimeout-1, 0)})
+	assert.False(t, tkn.Expired())
+	tkn.WithClock(clock{time.Unix(1680000000+token.TokenTimeout, 0)})
+	assert.True(t, tkn.Expired())
 }
 
 func TestGenerateWithNoAuthKey(t *testing.T) {
@@ -94,3 +138,63 @@ func TestGenerateWithInvalidAuthKey(t *testing.T) {
 	assert.False(t, bool)
 	assert.Error(t, err)
 }
+
+func TestOnRefresh(t *testing.T) {
+	authKey, _ := token.AuthKeyFromFile("_fixtures/authkey-valid.p8")
+	tkn := &token.Token{AuthKey: authKey}
+	var refreshes []time.Time
+	tkn.OnRefresh(func(generatedAt time.Time) {
+		refreshes = append(refreshes, generatedAt)
+	})
+
+	tkn.GenerateIfExpired()
+	tkn.GenerateIfExpired()
+	assert.Len(t, refreshes, 1)
+	assert.Equal(t, tkn.IssuedAt, refreshes[0].Unix())
+
+	tkn.IssuedAt = time.Now().Add(-time.Hour).Unix()
+	tkn.GenerateIfExpired()
+	assert.Len(t, refreshes, 2)
+}
+
+// Rotation
+
+func TestRotate(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tkn := &token.Token{AuthKey: oldKey, KeyID: "OLDKEY1234"}
+	oldBearer := tkn.GenerateIfExpired()
+
+	assert.NoError(t, tkn.Rotate(newKey, "NEWKEY1234"))
+	bearer := tkn.GenerateIfExpired()
+	assert.NotEqual(t, oldBearer, bearer)
+
+	parsed, err := jwt.Parse(bearer, func(*jwt.Token) (interface{}, error) {
+		return &newKey.PublicKey, nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, parsed.Valid)
+	assert.Equal(t, "NEWKEY1234", parsed.Header["kid"])
+
+	_, err = jwt.Parse(bearer, func(*jwt.Token) (interface{}, error) {
+		return &oldKey.PublicKey, nil
+	})
+	assert.Error(t, err)
+}
+
+func TestRotateWithNilKey(t *testing.T) {
+	authKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tkn := &token.Token{AuthKey: authKey, KeyID: "OLDKEY1234"}
+	assert.Equal(t, token.ErrAuthKeyNil, tkn.Rotate(nil, "NEWKEY1234"))
+	assert.Equal(t, authKey, tkn.AuthKey)
+	assert.Equal(t, "OLDKEY1234", tkn.KeyID)
+}
+
+func TestRotateWithInvalidKeyKeepsPrevious(t *testing.T) {
+	authKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	badKey, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	tkn := &token.Token{AuthKey: authKey, KeyID: "OLDKEY1234"}
+	assert.Error(t, tkn.Rotate(badKey, "NEWKEY1234"))
+	assert.Equal(t, authKey, tkn.AuthKey)
+	assert.Equal(t, "OLDKEY1234", tkn.KeyID)
+}
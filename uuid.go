@@ -0,0 +1,50 @@
+package apns2
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+// ErrInvalidUUID is returned when an apns-id is not a canonically formatted
+// UUID.
+var ErrInvalidUUID = errors.New("apns2: apns-id is not a valid UUID")
+
+// UUID is an apns-id parsed into its 16 bytes, suitable for use as a map key
+// or for storage keyed on UUIDs without further parsing.
+type UUID [16]byte
+
+// ParseUUID parses a UUID in the canonical 8-4-4-4-12 hexadecimal form used
+// for apns-id values, such as "40636A2C-C093-493E-936A-2A4333C06DEA". Upper
+// and lower case hexadecimal digits are both accepted.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, ErrInvalidUUID
+	}
+	b := []byte(s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:])
+	if _, err := hex.Decode(u[:], b); err != nil {
+		return UUID{}, ErrInvalidUUID
+	}
+	return u, nil
+}
+
+// String returns the UUID in the canonical upper case form APNs uses for
+// apns-id values.
+func (u UUID) String() string {
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	for i, c := range b {
+		if c >= 'a' && c <= 'f' {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+	return string(b[:])
+}
@@ -0,0 +1,29 @@
+package apns2_test
+
+import (
+	"testing"
+
+	apns "github.com/mkc-bill/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseUUID(t *testing.T) {
+	res := &apns.Response{ApnsID: "40636a2c-c093-493e-936a-2a4333c06dea"}
+	uuid, err := res.UUID()
+	assert.NoError(t, err)
+	assert.Equal(t, apns.UUID{0x40, 0x63, 0x6a, 0x2c, 0xc0, 0x93, 0x49, 0x3e, 0x93, 0x6a, 0x2a, 0x43, 0x33, 0xc0, 0x6d, 0xea}, uuid)
+	assert.Equal(t, "40636A2C-C093-493E-936A-2A4333C06DEA", uuid.String())
+}
+
+func TestResponseUUIDMalformed(t *testing.T) {
+	for _, id := range []string{
+		"",
+		"40636A2C-C093-493E-936A-2A4333C06DE",
+		"40636A2CC093-493E-936A-2A4333C06DEA0",
+		"40636A2C-C093-493E-936A-2A4333C06DEZ",
+		"40636A2C+C093-493E-936A-2A4333C06DEA",
+	} {
+		_, err := (&apns.Response{ApnsID: id}).UUID()
+		assert.Equal(t, apns.ErrInvalidUUID, err, id)
+	}
+}